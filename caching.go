@@ -11,10 +11,12 @@ import (
 )
 
 const (
-	PathFeeds                        = "/feeds"
-	PathItems                        = "/items"
-	CacheDurationItems time.Duration = 15 * time.Minute
-	CacheDurationFeeds time.Duration = 6 * time.Hour
+	PathFeeds                             = "/feeds"
+	PathItems                             = "/items"
+	PathCategories                        = "/categories"
+	CacheDurationItems      time.Duration = 15 * time.Minute
+	CacheDurationFeeds      time.Duration = 6 * time.Hour
+	CacheDurationCategories time.Duration = 15 * time.Minute
 )
 
 func getAllFeedsFromCacheOrDB() interface{} {
@@ -29,11 +31,19 @@ func getAllFeedsFromCacheOrDB() interface{} {
 	return feedlist
 }
 
-func getItemsFromCacheOrDB(filter string, search string, limit int, offset int, timestamp int64) interface{} {
-	path := fmt.Sprintf("%s/%s/%s/%d/%d/%d", PathItems, filter, search, limit, timestamp, offset)
+func getItemsFromCacheOrDB(query feeds.ItemQuery, limit int, offset int, timestamp int64) interface{} {
+	// saved items change whenever the user saves one, so they are not cached
+	if query.SavedBy != "" {
+		items, err := feeds.QueryItems(query, limit, offset, timestamp)
+		if err != nil {
+			log.Panic(err)
+		}
+		return items
+	}
+	path := fmt.Sprintf("%s/%s/%d/%d/%d", PathItems, query, limit, timestamp, offset)
 	items, err := cache.GlobalCache.Get(path)
 	if err != nil {
-		items, err = feeds.Items(filter, search, limit, offset, timestamp)
+		items, err = feeds.QueryItems(query, limit, offset, timestamp)
 		if err != nil {
 			log.Panic(err)
 		}
@@ -42,6 +52,20 @@ func getItemsFromCacheOrDB(filter string, search string, limit int, offset int,
 	return items
 }
 
+// getCategoriesFromCacheOrDB returns the category names for the filter dropdown (see feeds.AllCategories).
+func getCategoriesFromCacheOrDB() []string {
+	categories, err := cache.GlobalCache.Get(PathCategories)
+	if err != nil {
+		categories, err = feeds.AllCategories(maxCategoryOptions)
+		if err != nil {
+			log.Printf("Error loading categories: %v", err)
+			return nil
+		}
+		cache.GlobalCache.Add(PathCategories, categories, time.Now().Add(CacheDurationCategories))
+	}
+	return categories.([]string)
+}
+
 func getUserKeywordsFromCacheorDB(username string) interface{} {
 	path := fmt.Sprintf("/keywords/%v", username)
 	kl, err := cache.GlobalCache.Get(path)
@@ -55,6 +79,11 @@ func getUserKeywordsFromCacheorDB(username string) interface{} {
 	return kl
 }
 
+// invalidateItemsCache drops all cached headline pages, e.g. after items were renamed.
+func invalidateItemsCache() {
+	cache.GlobalCache.InvalidatePrefix(PathItems + "/")
+}
+
 func invalidateKeywordCacheForUser(username string) {
 	path := fmt.Sprintf("/keywords/%v", username)
 	cache.GlobalCache.Invalidate(path)
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"github.com/signalstoerung/reader/internal/feeds"
@@ -37,10 +38,32 @@ func main() {
 			fmt.Printf("Expecting http(s) url. (%v)", err)
 			os.Exit(1)
 		}
+		candidates, isFeed, err := feeds.DiscoverFeeds(feedUrl.String())
+		if err != nil {
+			fmt.Printf("Could not find a feed at %v. (%v)\n", feedUrl, err)
+			os.Exit(1)
+		}
+		if !isFeed {
+			chosen := 0
+			if len(candidates) > 1 {
+				fmt.Println("Found several feeds on this page:")
+				for i, c := range candidates {
+					fmt.Printf("  [%d] %v (%v)\n", i+1, c.Title, c.Url)
+				}
+				fmt.Print("Select a feed: ")
+				if _, err := fmt.Scanln(&chosen); err != nil || chosen < 1 || chosen > len(candidates) {
+					fmt.Println("Invalid selection.")
+					os.Exit(1)
+				}
+				chosen--
+			}
+			log.Printf("using discovered feed %v", candidates[chosen].Url)
+			feedUrl, _ = url.Parse(candidates[chosen].Url)
+		}
 		feeds.CreateFeed(feeds.Feed{Name: abbr, Abbr: abbr, Url: feedUrl.String()})
 	default:
 		log.Println("poll & update db")
-		err = feeds.UpdateFeeds()
+		err = feeds.UpdateFeeds(context.Background())
 		if err != nil {
 			log.Printf("Error updating feeds: %v", err)
 			os.Exit(2)
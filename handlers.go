@@ -1,18 +1,24 @@
 package main
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"reflect"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/coder/websocket"
+	"github.com/mmcdole/gofeed"
+	"github.com/signalstoerung/reader/internal/cache"
 	"github.com/signalstoerung/reader/internal/feeds"
 	"github.com/signalstoerung/reader/internal/newsticker"
 	"github.com/signalstoerung/reader/internal/users"
@@ -20,7 +26,12 @@ import (
 	"golang.org/x/net/context"
 )
 
-const websocketMagicString = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+const (
+	websocketMagicString = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	maxSearchLength      = 200
+	maxCategoryOptions   = 50 // most frequent categories offered in the filter
+	maxApiBodyBytes      = 1 << 20
+)
 
 func loginHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
@@ -70,6 +81,11 @@ func headlinesHandler(w http.ResponseWriter, r *http.Request) {
 		feed = ""
 	}
 
+	category := strings.TrimSpace(r.FormValue("category"))
+	if utf8.RuneCountInString(category) > maxSearchLength {
+		category = ""
+	}
+
 	// get page number
 	page, err := strconv.Atoi(r.FormValue("page"))
 	if err != nil {
@@ -90,37 +106,49 @@ func headlinesHandler(w http.ResponseWriter, r *http.Request) {
 
 	pageData := make(map[string]interface{})
 
-	// get search term
-	rawSearch := r.FormValue("q")
-	var cleanSearch string
-	if !isAlphaNum(rawSearch) {
-		rawSearch = ""
-		pageData["Message"] = "Invalid search term. Only alphanumeric characters allowed."
-	} else {
-		cleanSearch = strings.TrimSpace(rawSearch)
+	// get search term - it is passed to the database as a parameter (and escaped for full-text search), so any characters are fine
+	cleanSearch := strings.TrimSpace(r.FormValue("q"))
+	if utf8.RuneCountInString(cleanSearch) > maxSearchLength {
+		cleanSearch = ""
+		pageData["Message"] = fmt.Sprintf("Search term too long (max. %d characters).", maxSearchLength)
+	} else if cleanSearch != "" {
 		pageData["SearchTerms"] = cleanSearch
 		log.Printf("Searching for '%s'", cleanSearch)
 	}
-	headlines := getItemsFromCacheOrDB(feed, cleanSearch, globalConfig.ResultsPerPage, offset, startTime).([]feeds.Item)
+	// parse operators like feed:NYT or score>80 in the search term
+	query, err := parseQuery(cleanSearch, feedlist, session.User)
+	if err != nil {
+		pageData["Message"] = fmt.Sprintf("Invalid search: %v.", err)
+		query = feeds.ItemQuery{}
+	}
+	if query.Feed == "" {
+		query.Feed = feed
+	}
+	if query.Category == "" {
+		query.Category = category
+	}
+	headlines := getItemsFromCacheOrDB(query, globalConfig.ResultsPerPage, offset, startTime).([]feeds.Item)
 	if startTime == 0 && len(headlines) > 0 {
 		startTime = headlines[0].PublishedParsed.Unix()
 	}
-	pageData["Headlines"] = ConvertItems(headlines, getUserKeywordsFromCacheorDB(session.User).(users.KeywordList))
+	pageData["Headlines"] = collapseClusters(ConvertItems(headlines, getUserKeywordsFromCacheorDB(session.User).(users.KeywordList)))
 	pageData["HeadlineCount"] = len(headlines)
 	pageData["Feeds"] = feedlist
+	pageData["Categories"] = getCategoriesFromCacheOrDB()
+	pageData["Category"] = category
 	pageData["Page"] = page
-	pageData["PrevPageLink"] = fmt.Sprintf("%s?page=%d&feed=%s&timestamp=%d&q=%s", r.URL.Path, page-1, feed, startTime, cleanSearch)
+	pageData["PrevPageLink"] = fmt.Sprintf("%s?page=%d&feed=%s&category=%s&timestamp=%d&q=%s", r.URL.Path, page-1, feed, url.QueryEscape(category), startTime, url.QueryEscape(cleanSearch))
 	if len(headlines) < globalConfig.ResultsPerPage {
 		pageData["NextPageLink"] = ""
 	} else {
-		pageData["NextPageLink"] = fmt.Sprintf("%s?page=%d&feed=%s&timestamp=%d&q=%s", r.URL.Path, page+1, feed, startTime, cleanSearch)
+		pageData["NextPageLink"] = fmt.Sprintf("%s?page=%d&feed=%s&category=%s&timestamp=%d&q=%s", r.URL.Path, page+1, feed, url.QueryEscape(category), startTime, url.QueryEscape(cleanSearch))
 	}
 
 	emitHTMLFromFile(w, HTMLHeaderPath)
 	defer emitHTMLFromFile(w, HTMLFooterPath)
 	templ := template.Must(template.ParseFiles("www/main.html"))
 	templ.Execute(w, pageData)
-	log.Printf("/items/%v/%s/%d/%v (user: %v)", feed, cleanSearch, startTime, page, session.User)
+	log.Printf("/items/%v/%s/%d/%v (user: %v)", feed, query, startTime, page, session.User)
 
 }
 
@@ -378,6 +406,19 @@ func keywordEditHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func feedEditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet && r.FormValue("action") == "export" {
+		feedlist, err := feeds.AllFeeds()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/x-opml; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="reader-feeds.opml"`)
+		if err := feeds.WriteOPML(w, feedlist); err != nil {
+			log.Printf("Error writing OPML: %v", err)
+		}
+		return
+	}
 	if r.Method == http.MethodGet {
 		// show form
 		emitHTMLFromFile(w, HTMLHeaderPath)
@@ -403,17 +444,126 @@ func feedEditHandler(w http.ResponseWriter, r *http.Request) {
 		var resultMessage string
 		switch r.FormValue("action") {
 		case "add":
-			feed, err := checkFeedForm(r.FormValue("name"), r.FormValue("abbr"), r.FormValue("url"))
+			feed, err := checkFeedForm(r.FormValue("name"), r.FormValue("abbr"), r.FormValue("url"), r.FormValue("interval"), r.FormValue("language"), r.FormValue("timezone"))
+			if err == nil {
+				err = checkSourceForm(&feed, r.FormValue("type"), scrapeSelectorsFromForm(r))
+			}
 			if err != nil {
 				resultMessage = fmt.Sprintf("Adding feed failed. (%v)", err)
+				break
+			}
+			pageData := map[string]interface{}{
+				"Feed":    feed,
+				"PageUrl": r.URL.Path,
+			}
+			var preview *feeds.FeedPreview
+			var candidates []feeds.FeedCandidate
+			if feed.Type == feeds.TypeRSS {
+				preview, candidates, err = feeds.PreviewFeed(feed.Url)
 			} else {
-				err = feeds.CreateFeed(feed)
-				if err != nil {
-					resultMessage = fmt.Sprintf("Creating feed failed. (%v)", err)
-				} else {
-					resultMessage = fmt.Sprintf("Feed %v successfully created.", feed.Name)
+				preview, err = feeds.PreviewSource(r.Context(), feed)
+			}
+			var httpErr gofeed.HTTPError
+			if errors.As(err, &httpErr) && (httpErr.StatusCode == http.StatusUnauthorized || httpErr.StatusCode == http.StatusForbidden) {
+				// paid or intranet feed - it can be subscribed to and given credentials afterwards
+				preview, err = &feeds.FeedPreview{Url: feed.Url}, nil
+				pageData["Notice"] = fmt.Sprintf("The feed requires authentication (%v). Subscribe, then set the request options under Edit.", httpErr.Status)
+			}
+			if err != nil {
+				resultMessage = fmt.Sprintf("Adding feed failed. (%v)", err)
+				break
+			}
+			if preview != nil && preview.ItemCount == 0 {
+				switch feed.Type {
+				case feeds.TypeMail:
+					pageData["Notice"] = "The mailbox has no messages yet. Newsletters that arrive after subscribing will show up as items."
+				case feeds.TypeAPI:
+					pageData["Notice"] = fmt.Sprintf("Items submitted to the item API with the source %v will show up once the source is created.", feed.Abbr)
+				}
+			}
+			var templatePath string
+			if preview == nil {
+				// the URL is a web page - offer the feeds found on it for selection
+				pageData["Candidates"] = candidates
+				templatePath = HTMLFeedDiscoverPath
+			} else {
+				// show a preview; the feed is only created once the user confirms
+				pageData["Preview"] = preview
+				if err := checkFeedDuplicates(feed); err != nil {
+					pageData["Error"] = err.Error()
 				}
+				templatePath = HTMLFeedPreviewPath
+			}
+			emitHTMLFromFile(w, HTMLHeaderPath)
+			defer emitHTMLFromFile(w, HTMLFooterPath)
+			templ := template.Must(template.ParseFiles(templatePath))
+			templ.Execute(w, pageData)
+			return
+		case "confirm":
+			feed, err := checkFeedForm(r.FormValue("name"), r.FormValue("abbr"), r.FormValue("url"), r.FormValue("interval"), r.FormValue("language"), r.FormValue("timezone"))
+			if err == nil {
+				err = checkSourceForm(&feed, r.FormValue("type"), scrapeSelectorsFromForm(r))
+			}
+			if err == nil {
+				err = checkFeedDuplicates(feed)
+			}
+			if err != nil {
+				resultMessage = fmt.Sprintf("Adding feed failed. (%v)", err)
+				break
 			}
+			err = feeds.CreateFeed(feed)
+			if err != nil {
+				resultMessage = fmt.Sprintf("Creating feed failed. (%v)", err)
+			} else {
+				resultMessage = fmt.Sprintf("Feed %v successfully created.", feed.Name)
+				cache.GlobalCache.Invalidate(PathFeeds)
+			}
+		case "edit":
+			id, err := strconv.Atoi(r.FormValue("ID"))
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid ID: %v", err), http.StatusBadRequest)
+				return
+			}
+			resultMessage = editFeed(uint(id), r.FormValue("name"), r.FormValue("abbr"), r.FormValue("url"), r.FormValue("interval"), r.FormValue("language"), r.FormValue("timezone"), r.FormValue("paused") == "on", r.FormValue("fullText") == "on")
+			cache.GlobalCache.Invalidate(PathFeeds)
+		case "selectors":
+			id, err := strconv.Atoi(r.FormValue("ID"))
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid ID: %v", err), http.StatusBadRequest)
+				return
+			}
+			resultMessage = editScrapeSelectors(uint(id), scrapeSelectorsFromForm(r))
+			cache.GlobalCache.Invalidate(PathFeeds)
+		case "options":
+			id, err := strconv.Atoi(r.FormValue("ID"))
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid ID: %v", err), http.StatusBadRequest)
+				return
+			}
+			opts := feeds.RequestOptions{
+				AuthType:    r.FormValue("authType"),
+				AuthUser:    strings.TrimSpace(r.FormValue("authUser")),
+				AuthSecret:  r.FormValue("authSecret"),
+				HeaderName:  strings.TrimSpace(r.FormValue("headerName")),
+				HeaderValue: r.FormValue("headerValue"),
+				Cookies:     strings.TrimSpace(r.FormValue("cookies")),
+				Proxy:       strings.TrimSpace(r.FormValue("proxy")),
+			}
+			resultMessage = editFeedOptions(uint(id), opts, r.FormValue("clear") == "on")
+		case "import":
+			file, _, err := r.FormFile("opml")
+			if err != nil {
+				resultMessage = fmt.Sprintf("Import failed: no file uploaded. (%v)", err)
+				break
+			}
+			defer file.Close()
+			added, skipped, err := importOPML(file)
+			if err != nil {
+				resultMessage = fmt.Sprintf("Import failed. (%v)", err)
+				break
+			}
+			resultMessage = fmt.Sprintf("Imported %d feed(s): %v. Skipped %d: %v.", len(added), strings.Join(added, ", "), len(skipped), strings.Join(skipped, ", "))
+			cache.GlobalCache.Invalidate(PathFeeds)
 		case "delete":
 			id, err := strconv.Atoi(r.FormValue("ID"))
 			if err != nil {
@@ -503,3 +653,90 @@ func proxyHandler(w http.ResponseWriter, r *http.Request) {
 
 	http.Redirect(w, r, archivePath, http.StatusMovedPermanently)
 }
+
+// websubHandler receives the callbacks of WebSub hubs for the feed whose ID follows the path: verifications of
+// subscription requests (GET) and pushed content (POST). It is not behind the session middleware, as hubs can't log in;
+// pushed content is authenticated with the subscription's secret instead.
+func websubHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, feeds.WebSubPath))
+	if err != nil || id <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		challenge, err := feeds.VerifyWebSub(uint(id), r.URL.Query())
+		if err != nil {
+			log.Printf("Rejecting WebSub verification for feed %d: %v", id, err)
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(challenge))
+	case http.MethodPost:
+		n, err := feeds.ReceiveWebSub(uint(id), r.Header.Get("X-Hub-Signature"), r.Body)
+		switch {
+		case errors.Is(err, feeds.ErrUnknownSubscription):
+			// tells the hub to drop the subscription
+			http.Error(w, err.Error(), http.StatusGone)
+		case errors.Is(err, feeds.ErrInvalidSignature), errors.Is(err, feeds.ErrInvalidContent):
+			// acknowledged anyway, so the hub doesn't retry content that will be rejected again
+			log.Printf("Ignoring content pushed for feed %d: %v", id, err)
+			w.WriteHeader(http.StatusAccepted)
+		case err != nil:
+			// the hub retries later
+			log.Printf("Error receiving content pushed for feed %d: %v", id, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		default:
+			if n > 0 {
+				log.Printf("Hub pushed %d new items for feed %d.", n, id)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// itemApiHandler accepts items from scripts: a POST with a JSON item, or an array of items, authenticated with the API
+// token from the config file as a bearer token. See feeds.InboundItem for the fields. Responds with a result per item.
+func itemApiHandler(w http.ResponseWriter, r *http.Request) {
+	if globalConfig.ApiToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(globalConfig.ApiToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="reader"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	items, err := decodeInboundItems(http.MaxBytesReader(w, r.Body, maxApiBodyBytes))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	results, err := feeds.IngestItems(items)
+	if errors.Is(err, feeds.ErrTooManyItems) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		log.Printf("Error storing submitted items: %v", err)
+		http.Error(w, "Error storing items", http.StatusInternalServerError)
+		return
+	}
+	stored := 0
+	for _, result := range results {
+		if result.Status == feeds.ItemStored {
+			stored++
+		}
+	}
+	log.Printf("Item API: %d of %d submitted items stored.", stored, len(items))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"stored": stored, "results": results})
+}
@@ -1,9 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 	"unicode"
 
 	"github.com/signalstoerung/reader/internal/feeds"
@@ -43,6 +50,204 @@ func firstN(s string, n int) string {
 	return s
 }
 
+// checkFeedDuplicates returns an error if a feed with the same URL or abbreviation already exists.
+func checkFeedDuplicates(feed feeds.Feed) error {
+	if feeds.FeedUrlExists(feed.Url) {
+		return fmt.Errorf("already subscribed to %v", feed.Url)
+	}
+	if feeds.FeedExists(feed.Abbr) {
+		return fmt.Errorf("abbreviation %v is already in use", feed.Abbr)
+	}
+	return nil
+}
+
+// editFeed validates the form values like checkFeedForm and applies them to the feed with the given id.
+// Returns a message for the user.
+func editFeed(id uint, name string, abbr string, formUrl string, formInterval string, language string, timezone string, paused bool, fullText bool) string {
+	existing, err := feeds.FeedById(id)
+	if err != nil {
+		return fmt.Sprintf("Feed not found. (%v)", err)
+	}
+	checked, err := checkFeedForm(name, abbr, formUrl, formInterval, language, timezone)
+	if err != nil {
+		return fmt.Sprintf("Editing feed failed. (%v)", err)
+	}
+	switch {
+	case existing.Type == feeds.TypeMail:
+		if checked.Url, err = feeds.ValidateMailboxUrl(checked.Url); err != nil {
+			return fmt.Sprintf("Editing feed failed. (%v)", err)
+		}
+	case existing.Type == feeds.TypeAPI:
+		checked.Url = feeds.APIUrl(checked.Abbr)
+	case feeds.IsMailboxUrl(checked.Url) || feeds.IsAPIUrl(checked.Url):
+		return "Editing feed failed. (expecting an http(s) url)"
+	}
+	if checked.Abbr != existing.Abbr && feeds.FeedExists(checked.Abbr) {
+		return fmt.Sprintf("Editing feed failed. (abbreviation %v is already in use)", checked.Abbr)
+	}
+	columns := []string{"Name", "Abbr", "Url", "Interval", "Language", "Timezone", "Paused", "FullText"}
+	if checked.Url != existing.Url {
+		// validators and health belong to the old URL
+		columns = append(columns, "ETag", "LastModified", "SitemapValidators", "ConsecutiveFailures", "LastError", "NextFetch")
+		existing.ETag = ""
+		existing.LastModified = ""
+		existing.SitemapValidators = ""
+		existing.ConsecutiveFailures = 0
+		existing.LastError = ""
+		existing.NextFetch = nil
+	}
+	if checked.Interval != existing.Interval {
+		columns = append(columns, "CurrentInterval", "NextFetch")
+		existing.CurrentInterval = 0
+		existing.NextFetch = nil
+	}
+	renamed := checked.Abbr != existing.Abbr
+	existing.Name = checked.Name
+	existing.Abbr = checked.Abbr
+	existing.Url = checked.Url
+	existing.Interval = checked.Interval
+	existing.Language = checked.Language
+	existing.Timezone = checked.Timezone
+	existing.Paused = paused
+	existing.FullText = fullText
+	if err := feeds.SaveFeed(existing, columns...); err != nil {
+		return fmt.Sprintf("Saving feed failed. (%v)", err)
+	}
+	if renamed {
+		// cached headlines still show the old abbreviation
+		invalidateItemsCache()
+	}
+	if paused {
+		return fmt.Sprintf("Feed %v saved (paused).", existing.Name)
+	}
+	return fmt.Sprintf("Feed %v saved.", existing.Name)
+}
+
+// editFeedOptions applies request options to the feed with the given id. Secret values left empty in opts are kept;
+// if clear is set, all options are removed instead. Returns a message for the user.
+func editFeedOptions(id uint, opts feeds.RequestOptions, clear bool) string {
+	existing, err := feeds.FeedById(id)
+	if err != nil {
+		return fmt.Sprintf("Feed not found. (%v)", err)
+	}
+	if clear {
+		existing.ClearRequestOptions()
+	} else if err := existing.SetRequestOptions(opts); err != nil {
+		return fmt.Sprintf("Saving request options failed. (%v)", err)
+	}
+	// the new settings may fix a failing feed, so try again right away
+	existing.NextFetch = nil
+	if err := feeds.SaveFeed(existing, append(feeds.RequestOptionColumns, "NextFetch")...); err != nil {
+		return fmt.Sprintf("Saving feed failed. (%v)", err)
+	}
+	if clear {
+		return fmt.Sprintf("Request options for %v removed.", existing.Name)
+	}
+	return fmt.Sprintf("Request options for %v saved.", existing.Name)
+}
+
+// checkSourceForm validates the source type and, for TypeScrape, the selectors, and sets them on feed.
+// Mail sources must have a mailbox as their URL and API sources get theirs from the abbreviation; all others need a web URL.
+func checkSourceForm(feed *feeds.Feed, sourceType string, selectors feeds.ScrapeSelectors) error {
+	if (sourceType != feeds.TypeMail && feeds.IsMailboxUrl(feed.Url)) || (sourceType != feeds.TypeAPI && feeds.IsAPIUrl(feed.Url)) {
+		return errors.New("expecting an http(s) url")
+	}
+	switch sourceType {
+	case feeds.TypeRSS:
+		return nil
+	case feeds.TypeScrape:
+		if err := selectors.Validate(); err != nil {
+			return err
+		}
+		feed.Type, feed.Scrape = sourceType, selectors
+		return nil
+	case feeds.TypeMail:
+		mailbox, err := feeds.ValidateMailboxUrl(feed.Url)
+		if err != nil {
+			return err
+		}
+		feed.Type, feed.Url = sourceType, mailbox
+		return nil
+	case feeds.TypeAPI:
+		feed.Type, feed.Url = sourceType, feeds.APIUrl(feed.Abbr)
+		return nil
+	case feeds.TypeSitemap:
+		feed.Type = sourceType
+		return nil
+	default:
+		return fmt.Errorf("unknown source type '%s'", sourceType)
+	}
+}
+
+// scrapeSelectorsFromForm reads the CSS selectors of a TypeScrape source from a form.
+func scrapeSelectorsFromForm(r *http.Request) feeds.ScrapeSelectors {
+	return feeds.ScrapeSelectors{
+		Item:        strings.TrimSpace(r.FormValue("scrapeItem")),
+		Title:       strings.TrimSpace(r.FormValue("scrapeTitle")),
+		Link:        strings.TrimSpace(r.FormValue("scrapeLink")),
+		Date:        strings.TrimSpace(r.FormValue("scrapeDate")),
+		DateLayout:  strings.TrimSpace(r.FormValue("scrapeDateLayout")),
+		Description: strings.TrimSpace(r.FormValue("scrapeDescription")),
+	}
+}
+
+// editScrapeSelectors sets the selectors of the TypeScrape source with the given id. Returns a message for the user.
+func editScrapeSelectors(id uint, selectors feeds.ScrapeSelectors) string {
+	existing, err := feeds.FeedById(id)
+	if err != nil {
+		return fmt.Sprintf("Feed not found. (%v)", err)
+	}
+	if existing.Type != feeds.TypeScrape {
+		return fmt.Sprintf("%v is not an HTML page source.", existing.Name)
+	}
+	if err := selectors.Validate(); err != nil {
+		return fmt.Sprintf("Saving selectors failed. (%v)", err)
+	}
+	existing.Scrape = selectors
+	existing.NextFetch = nil
+	if err := feeds.SaveFeed(existing, append(feeds.ScrapeColumns, "NextFetch")...); err != nil {
+		return fmt.Sprintf("Saving feed failed. (%v)", err)
+	}
+	return fmt.Sprintf("Selectors for %v saved.", existing.Name)
+}
+
+// abbrFromName derives a feed abbreviation (max 4 letters) from a feed name. If the abbreviation is already taken,
+// the last letter is replaced until a free one is found. Returns "" if no free abbreviation could be derived.
+func abbrFromName(name string, taken func(string) bool) string {
+	var letters strings.Builder
+	for _, l := range name {
+		if isAlpha(string(l)) {
+			letters.WriteRune(unicode.ToUpper(l))
+		}
+	}
+	abbr := firstN(letters.String(), 4)
+	if abbr == "" {
+		abbr = "FEED"
+	}
+	if !taken(abbr) {
+		return abbr
+	}
+	prefix := firstN(abbr, 3)
+	for l := 'A'; l <= 'Z'; l++ {
+		candidate := prefix + string(l)
+		if !taken(candidate) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// cleanFeedName removes characters that checkFeedForm would reject from a feed name imported from elsewhere.
+func cleanFeedName(name string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		if isAlphaNum(string(r)) {
+			return r
+		}
+		return ' '
+	}, name)
+	return strings.Join(strings.Fields(cleaned), " ")
+}
+
 func expandUrlRecursive(shortUrl string) string {
 	client := http.Client{
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
@@ -56,19 +261,73 @@ func expandUrlRecursive(shortUrl string) string {
 	return shortUrl
 }
 
-func checkFeedForm(name string, abbr string, formUrl string) (resultItem feeds.Feed, err error) {
+func checkFeedForm(name string, abbr string, formUrl string, formInterval string, language string, timezone string) (resultItem feeds.Feed, err error) {
 	if !isAlphaNum(name) || !isAlpha(abbr) {
 		err = errors.New("name or abbr contains invalid characters")
 		return
 	}
-	_, err = url.Parse(formUrl)
+	parsedUrl, err := url.Parse(formUrl)
 	if err != nil {
 		return
 	}
+	// mail and API sources have a mailbox or no URL instead, see checkSourceForm
+	if !feeds.IsMailboxUrl(formUrl) && !feeds.IsAPIUrl(formUrl) && ((parsedUrl.Scheme != "http" && parsedUrl.Scheme != "https") || parsedUrl.Host == "") {
+		err = errors.New("expecting an http(s) url")
+		return
+	}
+	// interval is optional; empty or 0 means the default update frequency
+	var interval int
+	if formInterval != "" {
+		interval, err = strconv.Atoi(formInterval)
+		if err != nil || interval < 0 {
+			err = errors.New("interval must be a positive number of minutes")
+			return
+		}
+	}
+	// language is optional; if set, it must be a two-letter code (e.g. NL) and items will be translated
+	if language != "" && (len(language) != 2 || !isAlpha(language)) {
+		err = errors.New("language must be a two-letter code such as NL")
+		return
+	}
+	// timezone is optional; it applies to dates the feed publishes without an offset
+	timezone = strings.TrimSpace(timezone)
+	if timezone != "" {
+		if _, tzErr := time.LoadLocation(timezone); tzErr != nil {
+			err = fmt.Errorf("unknown time zone '%s' (use e.g. Europe/Amsterdam)", timezone)
+			return
+		}
+	}
 	resultItem = feeds.Feed{
-		Name: name,
-		Abbr: abbr,
-		Url:  formUrl,
+		Name:     name,
+		Abbr:     abbr,
+		Url:      formUrl,
+		Interval: interval,
+		Language: strings.ToUpper(language),
+		Timezone: timezone,
 	}
 	return
 }
+
+// decodeInboundItems reads the body of an item API request: a single JSON item or an array of items.
+func decodeInboundItems(body io.Reader) ([]feeds.InboundItem, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+	var items []feeds.InboundItem
+	if bytes.HasPrefix(data, []byte("[")) {
+		err = json.Unmarshal(data, &items)
+	} else {
+		var item feeds.InboundItem
+		err = json.Unmarshal(data, &item)
+		items = append(items, item)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, errors.New("no items")
+	}
+	return items, nil
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"html/template"
+	"strings"
 
 	"github.com/signalstoerung/reader/internal/feeds"
 	"github.com/signalstoerung/reader/internal/users"
@@ -21,12 +23,23 @@ type HeadlineItem struct {
 	FeedAbbr           string
 	Timestamp          string
 	Preview            string
+	OriginalTitle      string // set if Title and Preview are translations
+	OriginalPreview    string
 	Link               string
 	AlertClass         string
 	Redacted           bool
 	BreakingNewsReason string
 	Id                 int
 	ItemId             int
+	ClusterID          uint
+	Updated            string        // time of the last revision by the publisher, empty if never revised
+	FullText           []string      // paragraphs of the extracted article, if any
+	RichContent        template.HTML // sanitized content from the feed, if it has more than the preview
+	ImageUrl           string
+	Authors            string
+	Categories         []string
+	Enclosures         []feeds.Enclosure
+	Related            []HeadlineItem // other items of the same story cluster, collapsed into this one
 }
 
 const (
@@ -35,6 +48,8 @@ const (
 	HTMLMainHeadlinesPath  = "www/main.html"
 	HTMLFeedFormPath       = "www/feedform.html"
 	HTMLFeedFormResultPath = "www/feedform-result.html"
+	HTMLFeedDiscoverPath   = "www/feedform-discover.html"
+	HTMLFeedPreviewPath    = "www/feedform-preview.html"
 	HTMLRegisterFormPath   = "www/register-form.html"
 	HTMLLoginFormPath      = "www/login-form.html"
 	HTMLKeywordFormPath    = "www/keywordform.html"
@@ -47,7 +62,32 @@ func ConvertItems(in []feeds.Item, keywordList users.KeywordList) []HeadlineItem
 		if item.Description != "" {
 			preview = item.Description
 		} else {
-			preview = item.Content
+			preview = feeds.HTMLToText(item.Content)
+		}
+		title := item.Title
+		var originalTitle, originalPreview string
+		if item.TitleTranslated != "" {
+			originalTitle, originalPreview = item.Title, preview
+			title = item.TitleTranslated
+			if item.DescriptionTranslated != "" {
+				preview = item.DescriptionTranslated
+			}
+		}
+		var fullText []string
+		var richContent template.HTML
+		if item.ArticleText != "" {
+			fullText = strings.Split(item.ArticleText, feeds.ParagraphSep)
+		} else if item.Content != "" && len(feeds.HTMLToText(item.Content)) > len(preview) {
+			// the feed's content says more than the preview; sanitized again in case it was stored before sanitizing
+			richContent = template.HTML(feeds.SanitizeHTML(item.Content))
+		}
+		var categories []string
+		for _, c := range item.Categories {
+			categories = append(categories, c.Name)
+		}
+		var updated string
+		if item.RevisedAt != nil {
+			updated = item.RevisedAt.In(globalConfig.localTZ).Format("15:04")
 		}
 		var alertClass string
 		switch {
@@ -62,7 +102,7 @@ func ConvertItems(in []feeds.Item, keywordList users.KeywordList) []HeadlineItem
 		}
 
 		// keywords override alert classes
-		mode, keyword := keywordList.Match(item.Title)
+		mode, keyword := keywordList.Match(item.Title + " " + item.TitleTranslated)
 		if mode == users.HighlightMode {
 			item.BreakingNewsReason = fmt.Sprintf("* Keyword '%v' triggered * %v", keyword, item.BreakingNewsReason)
 			alertClass = "alert"
@@ -73,16 +113,65 @@ func ConvertItems(in []feeds.Item, keywordList users.KeywordList) []HeadlineItem
 		}
 
 		returnItems = append(returnItems, HeadlineItem{
-			Title:              item.Title,
+			Title:              title,
 			FeedAbbr:           item.FeedAbbr,
 			Timestamp:          item.PublishedParsed.In(globalConfig.localTZ).Format("02 Jan 15:04"),
 			Preview:            preview,
+			OriginalTitle:      originalTitle,
+			OriginalPreview:    originalPreview,
 			Link:               item.Link,
 			AlertClass:         alertClass,
 			BreakingNewsReason: item.BreakingNewsReason,
 			Id:                 count,
 			ItemId:             int(item.ID),
+			ClusterID:          item.ClusterID,
+			Updated:            updated,
+			FullText:           fullText,
+			RichContent:        richContent,
+			ImageUrl:           item.ImageUrl,
+			Authors:            item.Authors,
+			Categories:         categories,
+			Enclosures:         item.Enclosures,
 		})
 	}
 	return returnItems
 }
+
+// collapseClusters folds items that belong to the same story cluster into the first (newest) of them,
+// which lists the others in Related. The most urgent alert class of the cluster is kept.
+func collapseClusters(in []HeadlineItem) []HeadlineItem {
+	var out = make([]HeadlineItem, 0, len(in))
+	position := make(map[uint]int) // cluster ID -> index in out
+	for _, item := range in {
+		if item.ClusterID == 0 {
+			out = append(out, item)
+			continue
+		}
+		idx, ok := position[item.ClusterID]
+		if !ok {
+			position[item.ClusterID] = len(out)
+			out = append(out, item)
+			continue
+		}
+		lead := &out[idx]
+		lead.Related = append(lead.Related, item)
+		if alertRank(item.AlertClass) > alertRank(lead.AlertClass) {
+			lead.AlertClass = item.AlertClass
+		}
+	}
+	return out
+}
+
+// alertRank orders alert classes by urgency; redacted items never raise the class of a cluster.
+func alertRank(class string) int {
+	switch class {
+	case "alert":
+		return 3
+	case "rush":
+		return 2
+	case "highlight":
+		return 1
+	default:
+		return 0
+	}
+}
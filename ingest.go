@@ -1,21 +1,56 @@
 package main
 
 import (
+	"context"
 	"log"
 	"time"
 
 	"github.com/signalstoerung/reader/internal/feeds"
 )
 
-// periodicUpdates waits for a tick to be transmitted from a time.Ticker and then triggers an update of the feeds.
-// It terminates when receiving anything on the q (quit) channel (or if the channel closes).
-func periodicUpdates(t *time.Ticker, q chan int) {
+// periodicUpdates waits for a tick to be transmitted from a time.Ticker and then updates the feeds that are due
+// (and the WebSub subscriptions of those with a hub).
+// Scoring is triggered when new items came in, but at most once every UpdateFrequency minutes; items that arrive in between
+// are scored as soon as the interval has passed.
+// It terminates when receiving anything on the q (quit) channel (or if the channel closes); cancelling ctx aborts fetches in progress.
+func periodicUpdates(ctx context.Context, t *time.Ticker, q chan int) {
+	var lastScoring time.Time
+	scoringPending := false
+	scoringInterval := time.Duration(globalConfig.UpdateFrequency) * time.Minute
 	for {
 		select {
 		case <-t.C:
-			log.Print("Periodic feed update triggered.")
-			feeds.UpdateFeeds()
-			if globalConfig.AIActive {
+			if requests, err := feeds.SyncWebSub(ctx); err != nil {
+				log.Printf("Error syncing WebSub subscriptions: %v", err)
+			} else if requests > 0 {
+				log.Printf("Sent %d WebSub subscription requests.", requests)
+			}
+			newItems, err := feeds.UpdateDueFeeds(ctx)
+			if err != nil {
+				log.Printf("Error updating feeds: %v", err)
+				continue
+			}
+			if newItems == 0 && !scoringPending {
+				continue
+			}
+			if newItems > 0 {
+				log.Printf("Feed update found %d new items.", newItems)
+				if extracted, err := feeds.ExtractFullText(ctx); err != nil {
+					log.Printf("Error extracting full text: %v", err)
+				} else if extracted > 0 {
+					log.Printf("Extracted the full text of %d articles.", extracted)
+				}
+				translateNewItems()
+				if joined, err := feeds.ClusterNewItems(); err != nil {
+					log.Printf("Error clustering items: %v", err)
+				} else if joined > 0 {
+					log.Printf("%d new items joined an existing story cluster.", joined)
+				}
+				scoringPending = globalConfig.AIActive
+			}
+			if scoringPending && time.Since(lastScoring) >= scoringInterval {
+				lastScoring = time.Now()
+				scoringPending = false
 				triggerScoring()
 			}
 		case <-q:
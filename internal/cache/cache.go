@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"sync"
 	"time"
 )
@@ -63,6 +64,17 @@ func (c Cache) Invalidate(path string) {
 	delete(c, path)
 }
 
+// InvalidatePrefix removes all entries whose path starts with prefix.
+func (c Cache) InvalidatePrefix(prefix string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	for key := range c {
+		if strings.HasPrefix(key, prefix) {
+			delete(c, key)
+		}
+	}
+}
+
 func (c Cache) Get(path string) (interface{}, error) {
 	mutex.Lock()
 	defer mutex.Unlock()
@@ -0,0 +1,121 @@
+// Package deepl translates text through the DeepL API (https://developers.deepl.com/docs/api-reference/translate).
+package deepl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	ApiBaseFree       = "https://api-free.deepl.com"
+	ApiBasePro        = "https://api.deepl.com"
+	translateEndpoint = "/v2/translate"
+	DefaultTargetLang = "EN-GB"
+	MaxTextsPerCall   = 50 // the API accepts up to 50 texts per request
+)
+
+var (
+	Config          = Configuration{}
+	Debug           bool
+	ErrNoApiKey     = errors.New("no DeepL API key configured")
+	ErrTooManyTexts = fmt.Errorf("too many texts (max. %d per request)", MaxTextsPerCall)
+)
+
+type Configuration struct {
+	ApiKey     string
+	ApiBase    string // e.g. ApiBaseFree; a local stand-in can be used for testing
+	TargetLang string
+}
+
+// Configure sets the API key, base URL and target language. If apiBase is empty, it is derived from the key
+// (free keys end in ":fx"). If targetLang is empty, DefaultTargetLang is used.
+func (c *Configuration) Configure(apiKey string, apiBase string, targetLang string) {
+	c.ApiKey = apiKey
+	if apiBase == "" {
+		if strings.HasSuffix(apiKey, ":fx") {
+			apiBase = ApiBaseFree
+		} else {
+			apiBase = ApiBasePro
+		}
+	}
+	c.ApiBase = strings.TrimRight(apiBase, "/")
+	if targetLang == "" {
+		targetLang = DefaultTargetLang
+	}
+	c.TargetLang = strings.ToUpper(targetLang)
+}
+
+// Active reports whether an API key has been configured (the sample config's placeholder doesn't count).
+func (c *Configuration) Active() bool {
+	return c.ApiKey != "" && c.ApiKey != "..."
+}
+
+type translateRequest struct {
+	Text       []string `json:"text"`
+	SourceLang string   `json:"source_lang,omitempty"`
+	TargetLang string   `json:"target_lang"`
+}
+
+type translateResponse struct {
+	Translations []struct {
+		DetectedSourceLanguage string `json:"detected_source_language"`
+		Text                   string `json:"text"`
+	} `json:"translations"`
+}
+
+// Translate translates texts from sourceLang (e.g. "NL"; empty for auto-detection) into the configured target language.
+// The result has the same length and order as texts.
+func Translate(texts []string, sourceLang string) ([]string, error) {
+	if !Config.Active() {
+		return nil, ErrNoApiKey
+	}
+	if len(texts) > MaxTextsPerCall {
+		return nil, ErrTooManyTexts
+	}
+	reqBody, err := json.Marshal(translateRequest{Text: texts, SourceLang: strings.ToUpper(sourceLang), TargetLang: Config.TargetLang})
+	if err != nil {
+		return nil, err
+	}
+	r, err := http.NewRequest(http.MethodPost, Config.ApiBase+translateEndpoint, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Authorization", "DeepL-Auth-Key "+Config.ApiKey)
+	r.Header.Set("Content-Type", "application/json")
+
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("DeepL request failed - %v / %v", resp.StatusCode, resp.Status)
+		body, err := io.ReadAll(resp.Body)
+		if err == nil && Debug {
+			log.Println(string(body))
+		}
+		return nil, fmt.Errorf("DeepL request failed with status code %d: %s", resp.StatusCode, resp.Status)
+	}
+
+	var decoded translateResponse
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return nil, err
+	}
+	if len(decoded.Translations) != len(texts) {
+		return nil, fmt.Errorf("expected %d translations, got %d", len(texts), len(decoded.Translations))
+	}
+	result := make([]string, len(texts))
+	for i, t := range decoded.Translations {
+		result[i] = t.Text
+	}
+	return result, nil
+}
@@ -0,0 +1,63 @@
+package deepl
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// standIn answers translation requests like the DeepL API, with the texts in upper case.
+func standIn(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != translateEndpoint || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "DeepL-Auth-Key test-key" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		var req translateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decoding request: %v", err)
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		if req.SourceLang != "NL" || req.TargetLang != "EN-GB" {
+			t.Errorf("languages %q -> %q, want NL -> EN-GB", req.SourceLang, req.TargetLang)
+		}
+		var resp translateResponse
+		for _, text := range req.Text {
+			resp.Translations = append(resp.Translations, struct {
+				DetectedSourceLanguage string `json:"detected_source_language"`
+				Text                   string `json:"text"`
+			}{req.SourceLang, strings.ToUpper(text)})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+func TestTranslate(t *testing.T) {
+	server := standIn(t)
+	defer server.Close()
+	defer func(c Configuration) { Config = c }(Config)
+
+	Config.Configure("test-key", server.URL+"/", "")
+	translated, err := Translate([]string{"hallo", "", "wereld"}, "nl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(translated, "|") != "HALLO||WERELD" {
+		t.Errorf("got %q", translated)
+	}
+
+	Config.Configure("wrong-key", server.URL, "")
+	if _, err := Translate([]string{"hallo"}, "nl"); err == nil {
+		t.Error("expected an error for a rejected key")
+	}
+	if _, err := Translate(make([]string, MaxTextsPerCall+1), "nl"); err != ErrTooManyTexts {
+		t.Errorf("got %v, want ErrTooManyTexts", err)
+	}
+}
@@ -0,0 +1,132 @@
+package feeds
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mmcdole/gofeed"
+	"gorm.io/gorm"
+)
+
+// Results of IngestItems for a single item.
+const (
+	ItemStored    = "stored"    // new, or a known item whose title or description changed
+	ItemDuplicate = "duplicate" // already known and unchanged
+	ItemRejected  = "rejected"
+)
+
+const (
+	MaxInboundItems       = 100 // per call of IngestItems
+	maxInboundTitle       = 500 // runes
+	maxInboundLink        = 2048
+	maxInboundDescription = 10000
+	apiSourcePrefix       = "api:"
+)
+
+var ErrTooManyItems = fmt.Errorf("too many items (at most %d per request)", MaxInboundItems)
+
+// InboundItem is an item submitted through the item API.
+type InboundItem struct {
+	Title       string `json:"title"`
+	Link        string `json:"link"`
+	Description string `json:"description"` // text or HTML
+	Published   string `json:"published"`   // RFC 3339, e.g. 2026-10-17T09:30:00+02:00; optional, default: now
+	Source      string `json:"source"`      // abbreviation of the TypeAPI source the item belongs to
+}
+
+// InboundResult reports what IngestItems did with the item at Index.
+type InboundResult struct {
+	Index  int    `json:"index"`
+	Status string `json:"status"` // ItemStored, ItemDuplicate or ItemRejected
+	Error  string `json:"error,omitempty"`
+}
+
+// IsAPIUrl reports whether u is the address of an API source (TypeAPI), which has no URL to fetch.
+func IsAPIUrl(u string) bool {
+	return strings.HasPrefix(u, apiSourcePrefix)
+}
+
+// APIUrl returns the address of the API source with the given abbreviation.
+func APIUrl(abbr string) string {
+	return apiSourcePrefix + strings.ToLower(abbr)
+}
+
+// Validate checks the fields of an item and returns its publish date (nil if none was given).
+func (i InboundItem) Validate() (*time.Time, error) {
+	if strings.TrimSpace(i.Title) == "" {
+		return nil, errors.New("title is required")
+	}
+	if utf8.RuneCountInString(i.Title) > maxInboundTitle {
+		return nil, fmt.Errorf("title is longer than %d characters", maxInboundTitle)
+	}
+	if len(i.Link) > maxInboundLink || !safeURL(i.Link, "http", "https") {
+		return nil, errors.New("link must be an http(s) URL")
+	}
+	if utf8.RuneCountInString(i.Description) > maxInboundDescription {
+		return nil, fmt.Errorf("description is longer than %d characters", maxInboundDescription)
+	}
+	if strings.TrimSpace(i.Source) == "" {
+		return nil, errors.New("source is required")
+	}
+	if i.Published == "" {
+		return nil, nil
+	}
+	published, err := time.Parse(time.RFC3339, i.Published)
+	if err != nil {
+		return nil, errors.New("published must be an RFC 3339 timestamp such as 2026-10-17T09:30:00+02:00")
+	}
+	return &published, nil
+}
+
+// IngestItems stores items submitted through the item API like polled items: under the TypeAPI source given by their Source
+// (which must exist and not be paused), deduplicated by their link, streamed to the ticker, and translated and scored
+// with the next feed update. Returns a result for every item.
+func IngestItems(items []InboundItem) ([]InboundResult, error) {
+	var db *gorm.DB
+	if db = Config.DB; db == nil {
+		return nil, ErrNoDBConnection
+	}
+	if len(items) > MaxInboundItems {
+		return nil, ErrTooManyItems
+	}
+	sources := make(map[string]*Feed)
+	results := make([]InboundResult, 0, len(items))
+	for index, i := range items {
+		result := InboundResult{Index: index, Status: ItemRejected}
+		published, err := i.Validate()
+		if err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+		source, ok := sources[i.Source]
+		if !ok {
+			var f Feed
+			if res := db.Where("abbr = ? AND type = ? AND paused = ?", i.Source, TypeAPI, false).Limit(1).Find(&f); res.Error != nil {
+				return results, res.Error
+			}
+			if f.ID != 0 {
+				source = &f
+			}
+			sources[i.Source] = source
+		}
+		if source == nil {
+			result.Error = fmt.Sprintf("unknown or paused custom source '%s'", i.Source)
+			results = append(results, result)
+			continue
+		}
+
+		item := &gofeed.Item{Title: strings.TrimSpace(i.Title), Link: i.Link, Description: i.Description, Published: i.Published, PublishedParsed: published}
+		n := writeItemsToDB(db, &gofeed.Feed{Title: source.Name, Items: []*gofeed.Item{item}}, source.Abbr, source.Location())
+		pushedItems.Add(int64(n))
+		result.Status = ItemDuplicate
+		if n > 0 {
+			result.Status = ItemStored
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
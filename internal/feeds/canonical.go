@@ -0,0 +1,237 @@
+package feeds
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/exp/slices"
+
+	"github.com/mmcdole/gofeed"
+	"gorm.io/gorm"
+)
+
+// trackingParams are query parameters that only serve to track where a click came from. They are removed from URLs before hashing.
+var trackingParams = map[string]bool{
+	"fbclid": true, "gclid": true, "dclid": true, "msclkid": true, "igshid": true, "mc_cid": true, "mc_eid": true, "_ga": true,
+	"cmpid": true, "ocid": true, "smid": true, "smtyp": true, "at_medium": true, "at_campaign": true, "at_custom1": true, "at_custom2": true,
+	"at_custom3": true, "at_custom4": true, "partner": true, "rss": true, "feature": true, "amp": true, "outputtype": true,
+}
+
+// CanonicalURL normalizes a link so that variants of the same article map to the same string: https instead of http,
+// lower-case host without "www." or "amp." and default port, no fragment, no tracking parameters (utm_* and others),
+// sorted query parameters, no AMP path suffix and no trailing slash. Links that can't be parsed are returned unchanged.
+func CanonicalURL(link string) string {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || u.Host == "" {
+		return link
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme == "http" {
+		u.Scheme = "https"
+	}
+	host := strings.ToLower(u.Hostname())
+	host = strings.TrimPrefix(host, "www.")
+	host = strings.TrimPrefix(host, "amp.")
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		host += ":" + port
+	}
+	u.Host = host
+	u.User = nil
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	// AMP variants
+	path := u.EscapedPath()
+	path = strings.TrimSuffix(path, "/")
+	path = strings.TrimSuffix(path, "/amp")
+	if strings.HasSuffix(path, ".amp.html") {
+		path = strings.TrimSuffix(path, ".amp.html") + ".html"
+	}
+	path = strings.TrimSuffix(path, ".amp")
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		u.Path = unescaped
+		u.RawPath = path
+	}
+
+	query := u.Query()
+	for key := range query {
+		lower := strings.ToLower(key)
+		if strings.HasPrefix(lower, "utm_") || trackingParams[lower] {
+			query.Del(key)
+		}
+	}
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, url.QueryEscape(key)+"="+url.QueryEscape(v))
+		}
+	}
+	u.RawQuery = strings.Join(parts, "&")
+	u.ForceQuery = false
+	return u.String()
+}
+
+// hashString returns the base64-encoded SHA1 hash of s, the format of Item.Hash.
+func hashString(s string) string {
+	hash := sha1.Sum([]byte(s))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// itemKey is the string the Hash of an item of the feed abbr is computed from: its GUID if the feed supplies one that isn't
+// a URL (such GUIDs are stable identifiers, but only within the feed, so the key includes the feed), otherwise the canonical
+// form of its GUID URL or link, which identifies the article across feeds.
+func itemKey(abbr string, guid string, link string) string {
+	if guid = strings.TrimSpace(guid); guid != "" {
+		if guidIsURL(guid) {
+			return CanonicalURL(guid)
+		}
+		return "guid:" + abbr + ":" + guid
+	}
+	return CanonicalURL(link)
+}
+
+func guidIsURL(guid string) bool {
+	u, err := url.Parse(guid)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https")
+}
+
+// itemHashes returns the Hash of an item of the feed abbr and the hashes under which it may have been stored: feedHashes
+// identify it among the items of the feed (its Hash if it has a GUID key, and the GUID hash without the feed that older versions
+// of Reader stored), globalHashes among all items (its Hash if it has a URL key, SHA1 of the canonical link and SHA1 of the raw
+// link), so existing items are recognized until they have been migrated.
+func itemHashes(item *gofeed.Item, abbr string) (hash string, feedHashes []string, globalHashes []string) {
+	hash = hashString(itemKey(abbr, item.GUID, item.Link))
+	if guid := strings.TrimSpace(item.GUID); guid != "" && !guidIsURL(guid) {
+		feedHashes = []string{hash, hashString("guid:" + guid)}
+	} else {
+		globalHashes = []string{hash}
+	}
+	if strings.TrimSpace(item.Link) == "" {
+		// the hash of an empty link would match every other item without one
+		return hash, feedHashes, globalHashes
+	}
+	for _, legacy := range []string{hashString(CanonicalURL(item.Link)), hashString(item.Link)} {
+		if !slices.Contains(globalHashes, legacy) {
+			globalHashes = append(globalHashes, legacy)
+		}
+	}
+	return hash, feedHashes, globalHashes
+}
+
+// rehashFeedItems recomputes the hashes of the items of the feed abbr that have a GUID key, which includes the feed (see itemKey).
+// Called when the feed's abbreviation changed.
+func rehashFeedItems(tx *gorm.DB, abbr string) error {
+	var items []Item
+	if result := tx.Select("id", "guid", "link", "hash").Where("feed_abbr = ? AND guid <> ''", abbr).Find(&items); result.Error != nil {
+		return result.Error
+	}
+	hashes := make(map[uint]string)
+	for _, i := range items {
+		if h := hashString(itemKey(abbr, i.GUID, i.Link)); h != i.Hash {
+			hashes[i.ID] = h
+		}
+	}
+	return updateHashes(tx, hashes)
+}
+
+// updateHashes sets the Hash of the items with the given IDs. The new hash of one item may still be the old hash of another
+// (e.g. when two feeds swap abbreviations), so all of them get a temporary hash first to keep the unique index satisfied.
+func updateHashes(tx *gorm.DB, hashes map[uint]string) error {
+	for id := range hashes {
+		if result := tx.Model(&Item{ID: id}).Update("hash", fmt.Sprintf("rehash:%d", id)); result.Error != nil {
+			return result.Error
+		}
+	}
+	for id, h := range hashes {
+		if result := tx.Model(&Item{ID: id}).Update("hash", h); result.Error != nil {
+			return result.Error
+		}
+	}
+	return nil
+}
+
+// MigrateCanonicalHashes recomputes the Hash of every item with the current rules and merges items that turn out to be
+// duplicates: the oldest item (lowest ID) is kept, saved-item references to the others are moved to it, and the highest
+// breaking news score is retained. This is a one-off migration for databases created before canonical hashing; running it
+// again is harmless. Returns the number of items deleted as duplicates and the number of hashes updated.
+func MigrateCanonicalHashes() (merged int, updated int, err error) {
+	var db *gorm.DB
+	if db = Config.DB; db == nil {
+		return 0, 0, ErrNoDBConnection
+	}
+	var items []Item
+	if result := db.Select("id", "feed_abbr", "link", "guid", "hash", "breaking_news_score", "breaking_news_reason").Order("id asc").Find(&items); result.Error != nil {
+		return 0, 0, result.Error
+	}
+	groups := make(map[string][]Item)
+	var order []string
+	for _, i := range items {
+		h := hashString(itemKey(i.FeedAbbr, i.GUID, i.Link))
+		if _, ok := groups[h]; !ok {
+			order = append(order, h)
+		}
+		groups[h] = append(groups[h], i)
+	}
+	hasSaved := db.Migrator().HasTable(savedItemsTable)
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		hashes := make(map[uint]string)
+		for _, h := range order {
+			group := groups[h]
+			keeper := group[0]
+			if keeper.Hash != h {
+				hashes[keeper.ID] = h
+			}
+			rescored := false
+			for _, dup := range group[1:] {
+				if hasSaved {
+					// a user may have saved both copies - ignore the conflict and drop the leftover reference
+					if result := tx.Exec("UPDATE OR IGNORE "+savedItemsTable+" SET item_id = ? WHERE item_id = ?", keeper.ID, dup.ID); result.Error != nil {
+						return result.Error
+					}
+					if result := tx.Exec("DELETE FROM "+savedItemsTable+" WHERE item_id = ?", dup.ID); result.Error != nil {
+						return result.Error
+					}
+				}
+				if dup.BreakingNewsScore > keeper.BreakingNewsScore {
+					keeper.BreakingNewsScore, keeper.BreakingNewsReason = dup.BreakingNewsScore, dup.BreakingNewsReason
+					rescored = true
+				}
+				if result := tx.Delete(&Item{}, dup.ID); result.Error != nil {
+					return result.Error
+				}
+				merged++
+			}
+			if !rescored {
+				continue
+			}
+			if result := tx.Model(&Item{ID: keeper.ID}).Updates(map[string]interface{}{
+				"breaking_news_score":  keeper.BreakingNewsScore,
+				"breaking_news_reason": keeper.BreakingNewsReason,
+			}); result.Error != nil {
+				return result.Error
+			}
+		}
+		// duplicates are gone now, but a new hash may still be the old hash of an item in a group that comes later
+		updated = len(hashes)
+		return updateHashes(tx, hashes)
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	if merged > 0 {
+		err = deleteOrphans(db)
+	}
+	return merged, updated, err
+}
@@ -0,0 +1,29 @@
+package feeds
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// An item without link or GUID is stored under the hash of the empty link; that must not hide link-less items of other feeds.
+func TestLinklessItemsOfDifferentFeeds(t *testing.T) {
+	defer func(c Configuration) { Config = c }(Config)
+	if err := Config.OpenDatabase("file::memory:"); err != nil {
+		t.Fatal(err)
+	}
+	published := time.Now().Add(-time.Hour)
+	newsletter := func(guid string) *gofeed.Feed {
+		return &gofeed.Feed{Items: []*gofeed.Item{{Title: "Issue 1", GUID: guid, PublishedParsed: &published}}}
+	}
+	if n := writeItemsToDB(Config.DB, newsletter(""), "A", time.UTC); n != 1 {
+		t.Fatalf("feed A: stored %d items, want 1", n)
+	}
+	if n := writeItemsToDB(Config.DB, newsletter("<1@b.example>"), "B", time.UTC); n != 1 {
+		t.Fatalf("feed B: stored %d items, want 1", n)
+	}
+	if n := writeItemsToDB(Config.DB, newsletter("<1@b.example>"), "B", time.UTC); n != 0 {
+		t.Errorf("feed B again: stored %d items, want 0", n)
+	}
+}
@@ -0,0 +1,132 @@
+package feeds
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+const (
+	clusterWindow     = 12 * time.Hour // items further apart than this are never clustered
+	clusterMaxAge     = 48 * time.Hour // older unclustered items are marked as singletons without comparing
+	clusterMinShared  = 3              // minimum number of shared title tokens
+	clusterMinJaccard = 0.3            // minimum Jaccard similarity of the title token sets
+	tokenLength       = 6              // tokens are cut to this many letters, a crude form of stemming
+)
+
+// stopwords are left out of title token sets (English, Dutch and German, matching the seeded feeds).
+var stopwords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "from": true, "after": true, "over": true, "into": true, "amid": true, "says": true, "said": true, "will": true, "has": true, "have": true, "are": true, "was": true, "its": true, "new": true, "not": true, "but": true, "who": true, "what": true, "how": true, "why": true, "more": true, "than": true, "this": true, "that": true, "his": true, "her": true, "they": true, "their": true, "about": true, "out": true,
+	"het": true, "een": true, "van": true, "voor": true, "met": true, "op": true, "niet": true, "dat": true, "die": true, "naar": true, "bij": true, "ook": true, "nog": true, "wordt": true, "zijn": true, "door": true, "uit": true,
+	"der": true, "das": true, "und": true, "mit": true, "von": true, "für": true, "auf": true, "den": true, "dem": true, "des": true, "ein": true, "eine": true, "ist": true, "nach": true, "nicht": true, "sich": true, "auch": true, "bei": true, "aus": true, "wird": true,
+}
+
+// titleTokens normalizes a title into a set of tokens: lower case, punctuation removed, stopwords and very short words dropped,
+// and every word cut to tokenLength letters.
+func titleTokens(title string) map[string]bool {
+	tokens := make(map[string]bool)
+	words := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, w := range words {
+		if len([]rune(w)) < 3 || stopwords[w] {
+			continue
+		}
+		if runes := []rune(w); len(runes) > tokenLength {
+			w = string(runes[:tokenLength])
+		}
+		tokens[w] = true
+	}
+	return tokens
+}
+
+// titleSimilarity returns the number of shared tokens and the Jaccard similarity of two token sets.
+func titleSimilarity(a, b map[string]bool) (int, float64) {
+	shared := 0
+	for t := range a {
+		if b[t] {
+			shared++
+		}
+	}
+	union := len(a) + len(b) - shared
+	if union == 0 {
+		return 0, 0
+	}
+	return shared, float64(shared) / float64(union)
+}
+
+// clusterTitle is the title used for comparison - the translation if there is one, so stories match across languages.
+func clusterTitle(i Item) string {
+	if i.TitleTranslated != "" {
+		return i.TitleTranslated
+	}
+	return i.Title
+}
+
+// ClusterNewItems assigns a ClusterID to every item that doesn't have one yet. An item joins the cluster of the most similar item
+// from a different feed published within clusterWindow, or starts a new cluster (ClusterID = its own ID).
+// Returns the number of items that joined an existing cluster.
+func ClusterNewItems() (int, error) {
+	var db *gorm.DB
+	if db = Config.DB; db == nil {
+		return 0, ErrNoDBConnection
+	}
+	unclustered := "cluster_id = 0 OR cluster_id IS NULL"
+
+	// don't bother comparing old items (e.g. on the first run after an upgrade)
+	cutoff := time.Now().Add(-clusterMaxAge)
+	if result := db.Model(&Item{}).Where(unclustered).Where("published_parsed < ?", cutoff).Update("cluster_id", gorm.Expr("id")); result.Error != nil {
+		return 0, result.Error
+	}
+
+	var pending []Item
+	if result := db.Where(unclustered).Order("published_parsed asc").Find(&pending); result.Error != nil {
+		return 0, result.Error
+	}
+	if len(pending) == 0 {
+		return 0, nil
+	}
+	var candidates []Item
+	earliest := pending[0].PublishedParsed.Add(-clusterWindow)
+	if result := db.Where("NOT ("+unclustered+") AND published_parsed >= ?", earliest).Find(&candidates); result.Error != nil {
+		return 0, result.Error
+	}
+	tokens := make(map[uint]map[string]bool, len(candidates)+len(pending))
+	for _, c := range candidates {
+		tokens[c.ID] = titleTokens(clusterTitle(c))
+	}
+
+	joined := 0
+	for _, p := range pending {
+		pTokens := titleTokens(clusterTitle(p))
+		tokens[p.ID] = pTokens
+		var best *Item
+		var bestScore float64
+		for i := range candidates {
+			c := &candidates[i]
+			if c.FeedAbbr == p.FeedAbbr {
+				continue
+			}
+			if diff := p.PublishedParsed.Sub(*c.PublishedParsed); diff > clusterWindow || diff < -clusterWindow {
+				continue
+			}
+			shared, score := titleSimilarity(pTokens, tokens[c.ID])
+			if shared >= clusterMinShared && score >= clusterMinJaccard && score > bestScore {
+				best, bestScore = c, score
+			}
+		}
+		if best != nil {
+			p.ClusterID = best.ClusterID
+			joined++
+		} else {
+			p.ClusterID = p.ID
+		}
+		if result := db.Model(&Item{ID: p.ID}).Update("cluster_id", p.ClusterID); result.Error != nil {
+			return joined, result.Error
+		}
+		candidates = append(candidates, p)
+	}
+	return joined, nil
+}
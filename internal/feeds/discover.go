@@ -0,0 +1,169 @@
+package feeds
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mmcdole/gofeed"
+)
+
+var ErrNoFeedsFound = errors.New("no feeds found on this page")
+
+// FeedCandidate is a feed found by DiscoverFeeds.
+type FeedCandidate struct {
+	Title string
+	Url   string
+	Type  string
+}
+
+// feedLinkTypes are the MIME types of <link rel="alternate"> elements that point to feeds.
+var feedLinkTypes = []string{"application/rss+xml", "application/atom+xml"}
+
+// FeedPreview summarizes a feed before subscribing to it.
+type FeedPreview struct {
+	Title        string
+	Url          string
+	ItemCount    int
+	Items        []PreviewItem // the latest items, newest first
+	MissingDates int           // items without a parsable publish date; these fall back to the update date or the time they are first seen
+}
+
+type PreviewItem struct {
+	Title     string
+	Link      string
+	Published *time.Time
+}
+
+const previewItemCount = 5
+
+// DiscoverFeeds fetches pageUrl. If it is a feed itself, a single candidate with pageUrl is returned and isFeed is true.
+// Otherwise the page is treated as HTML and scanned for <link rel="alternate"> elements pointing to RSS or Atom feeds.
+func DiscoverFeeds(pageUrl string) (candidates []FeedCandidate, isFeed bool, err error) {
+	feed, candidates, err := fetchAndDetect(pageUrl)
+	if err != nil {
+		return nil, false, err
+	}
+	if feed != nil {
+		return []FeedCandidate{{Title: feed.Title, Url: pageUrl, Type: feed.FeedType}}, true, nil
+	}
+	return candidates, false, nil
+}
+
+// PreviewFeed fetches and parses the feed at feedUrl and returns a preview with its latest items.
+// If feedUrl is a web page instead of a feed, the preview is nil and the feeds discovered on the page are returned.
+func PreviewFeed(feedUrl string) (*FeedPreview, []FeedCandidate, error) {
+	feed, candidates, err := fetchAndDetect(feedUrl)
+	if err != nil {
+		return nil, nil, err
+	}
+	if feed == nil {
+		return nil, candidates, nil
+	}
+	return newPreview(feed, feedUrl), nil, nil
+}
+
+// newPreview summarizes a parsed feed.
+func newPreview(feed *gofeed.Feed, feedUrl string) *FeedPreview {
+	preview := FeedPreview{Title: feed.Title, Url: feedUrl, ItemCount: len(feed.Items)}
+	items := make([]*gofeed.Item, len(feed.Items))
+	copy(items, feed.Items)
+	// newest first, undated items last
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i].PublishedParsed, items[j].PublishedParsed
+		if a == nil || b == nil {
+			return a != nil
+		}
+		return a.After(*b)
+	})
+	for _, item := range items {
+		if item.PublishedParsed == nil || item.PublishedParsed.IsZero() {
+			preview.MissingDates++
+		}
+		if len(preview.Items) < previewItemCount {
+			preview.Items = append(preview.Items, PreviewItem{Title: item.Title, Link: item.Link, Published: item.PublishedParsed})
+		}
+	}
+	return &preview
+}
+
+// fetchAndDetect fetches pageUrl and returns the parsed feed if it is one, or else the feeds linked from the HTML page.
+func fetchAndDetect(pageUrl string) (*gofeed.Feed, []FeedCandidate, error) {
+	_, _, _, userAgent := Config.fetcherSettings()
+	req, err := http.NewRequest(http.MethodGet, pageUrl, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	client := http.Client{Timeout: 20 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, nil, gofeed.HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFeedBytes+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(body) > maxFeedBytes {
+		return nil, nil, ErrFeedTooLarge
+	}
+
+	// is it a feed already?
+	if feed, err := gofeed.NewParser().Parse(bytes.NewReader(body)); err == nil {
+		return feed, nil, nil
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	// relative links refer to the page after redirects, or to its <base href>
+	base := resp.Request.URL
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+		if ref, err := url.Parse(strings.TrimSpace(href)); err == nil {
+			base = base.ResolveReference(ref)
+		}
+	}
+	var candidates []FeedCandidate
+	seen := make(map[string]bool)
+	doc.Find(`link[rel~="alternate"]`).Each(func(i int, s *goquery.Selection) {
+		linkType := strings.ToLower(strings.TrimSpace(s.AttrOr("type", "")))
+		href := strings.TrimSpace(s.AttrOr("href", ""))
+		if href == "" || !isFeedLinkType(linkType) {
+			return
+		}
+		ref, err := url.Parse(href)
+		if err != nil {
+			return
+		}
+		abs := base.ResolveReference(ref).String()
+		if seen[abs] {
+			return
+		}
+		seen[abs] = true
+		candidates = append(candidates, FeedCandidate{Title: strings.TrimSpace(s.AttrOr("title", "")), Url: abs, Type: linkType})
+	})
+	if len(candidates) == 0 {
+		return nil, nil, ErrNoFeedsFound
+	}
+	return nil, candidates, nil
+}
+
+func isFeedLinkType(t string) bool {
+	for _, ft := range feedLinkTypes {
+		if t == ft {
+			return true
+		}
+	}
+	return false
+}
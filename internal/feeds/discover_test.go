@@ -0,0 +1,35 @@
+package feeds
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDiscoverFeedsResolvesLinksAfterRedirect(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/old", http.RedirectHandler("/blog/", http.StatusMovedPermanently))
+	mux.HandleFunc("/blog/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><link rel="alternate" type="application/rss+xml" title="Posts" href="feed.xml"></head></html>`))
+	})
+	mux.HandleFunc("/news", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><base href="/static/"><link rel="alternate" type="application/atom+xml" href="atom.xml"></head></html>`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for page, want := range map[string]string{
+		"/old":  server.URL + "/blog/feed.xml",
+		"/news": server.URL + "/static/atom.xml",
+	} {
+		candidates, isFeed, err := DiscoverFeeds(server.URL + page)
+		if err != nil {
+			t.Fatalf("%v: %v", page, err)
+		}
+		if isFeed || len(candidates) != 1 || candidates[0].Url != want {
+			t.Errorf("%v: got %+v, want %v", page, candidates, want)
+		}
+	}
+}
@@ -1,13 +1,11 @@
 package feeds
 
 import (
-	"crypto/sha1"
-	"encoding/base64"
+	"context"
 	"errors"
 	"fmt"
 	"log"
-	"regexp"
-	"sync"
+	"sync/atomic"
 	"time"
 	"unicode/utf8"
 
@@ -23,13 +21,35 @@ var (
 	Config            = Configuration{}
 	ErrNoDBConnection = errors.New("no database connection")
 	ErrNotInCache     = errors.New("no item in cache for this path")
+	ErrNotModified    = errors.New("feed not modified since last fetch")
+
+	// pushedItems counts the items that arrived between polls (e.g. by mail). UpdateDueFeeds adds them to its result,
+	// so they are translated, clustered and scored like polled items.
+	pushedItems atomic.Int64
+)
+
+const (
+	FailureThreshold = 3 // consecutive failed fetches before a feed is flagged
 )
 
 // TYPES
 
 type Configuration struct {
-	DB            *gorm.DB
-	TickerChannel chan Item
+	DB              *gorm.DB
+	TickerChannel   chan Item
+	DefaultInterval int  // polling interval in minutes for feeds that don't set their own
+	FullTextSearch  bool // true if the FTS5 index is available
+	// fetcher, see SetFetcher
+	Workers      int
+	FetchTimeout time.Duration
+	HostDelay    time.Duration
+	UserAgent    string
+	secretKey    []byte // encrypts credentials, see SetSecret
+	MailboxDir   string // root of the Maildir and mbox mailboxes of mail sources, see SetMailboxDir
+	PublicUrl    string // where hubs reach Reader, see SetWebSub
+	// retention, see SetRetention
+	RetentionMaxAge     time.Duration
+	RetentionMaxPerFeed int
 }
 
 func (c *Configuration) OpenDatabase(path string) error {
@@ -39,6 +59,9 @@ func (c *Configuration) OpenDatabase(path string) error {
 	}
 	db.AutoMigrate(&Feed{})
 	db.AutoMigrate(&Item{})
+	db.AutoMigrate(&Revision{})
+	db.AutoMigrate(&Enclosure{}, &Category{})
+	c.FullTextSearch = setupFullTextSearch(db)
 	c.DB = db
 	return nil
 }
@@ -47,116 +70,268 @@ func (c *Configuration) SetTickerChannel(ch chan Item) {
 	c.TickerChannel = ch
 }
 
+func (c *Configuration) SetDefaultInterval(minutes int) {
+	c.DefaultInterval = minutes
+}
+
 // The Feed struct stores information about an RSS feed.
 type Feed struct {
 	gorm.Model
-	Name string
-	Abbr string
-	Url  string
+	Name         string
+	Abbr         string
+	Url          string
+	Type         string          // TypeRSS (default), TypeScrape, TypeSitemap, TypeMail or TypeAPI
+	Scrape       ScrapeSelectors `gorm:"embedded;embeddedPrefix:scrape_"`
+	Paused       bool            `gorm:"default:false"` // paused feeds are not polled
+	FullText     bool            `gorm:"default:false"` // download linked articles and store their text in Item.ArticleText, see ExtractFullText
+	Language     string          // source language (e.g. "NL") if items should be translated; "" for none
+	Timezone     string          // IANA time zone (e.g. "Europe/Amsterdam") for dates the feed publishes without an offset; "" for UTC
+	ETag         string          // validators from the last successful fetch, sent back for conditional GET
+	LastModified string
+	// validators of the sitemaps read from a sitemap index (TypeSitemap), see readSitemap
+	SitemapValidators string
+	// fetch health, updated on every poll
+	LastAttempt         *time.Time
+	LastSuccess         *time.Time
+	ConsecutiveFailures int
+	LastStatus          int
+	LastError           string
+	// scheduling
+	Interval        int        // polling interval in minutes; 0 means Config.DefaultInterval
+	CurrentInterval int        // interval after adaptive backoff, in minutes
+	NextFetch       *time.Time `gorm:"index"`
+	// request options, see RequestOptions; AuthSecret, HeaderValue, Cookies and Proxy are encrypted
+	AuthType    string
+	AuthUser    string
+	AuthSecret  string `json:"-"`
+	HeaderName  string
+	HeaderValue string `json:"-"`
+	Cookies     string `json:"-"`
+	Proxy       string `json:"-"`
+	// WebSub push subscription, see SyncWebSub
+	HubUrl      string     // hub the feed advertises; "" if it has none
+	TopicUrl    string     // the feed's self URL, which subscriptions are for
+	PushState   string     // PushNone, PushPending, PushActive or PushEnding
+	PushSecret  string     `json:"-"` // key of the HMAC signatures of pushed content
+	PushSince   *time.Time // when PushState last changed
+	PushExpires *time.Time // end of the lease granted by the hub
+	hubChanged  bool       // set by fetchFeed if HubUrl or TopicUrl changed
+}
+
+// Failing reports whether the feed has failed often enough in a row that it should be flagged in the UI.
+func (f Feed) Failing() bool {
+	return f.ConsecutiveFailures >= FailureThreshold
 }
 
 // The Item struct stores an item from an RSS feed.
 type Item struct {
-	ID                 uint `gorm:"primaryKey"`
-	CreatedAt          time.Time
-	UpdatedAt          time.Time
-	Title              string
-	FeedAbbr           string
-	Link               string
-	Description        string
-	Content            string
-	Hash               string `gorm:"uniqueIndex"`
-	BreakingNewsScore  int
-	BreakingNewsReason string
-	PublishedParsed    *time.Time `gorm:"index"`
+	ID                    uint `gorm:"primaryKey"`
+	CreatedAt             time.Time
+	UpdatedAt             time.Time
+	Title                 string
+	FeedAbbr              string
+	Link                  string
+	Description           string
+	Content               string
+	TitleTranslated       string // machine translations, set for items from feeds with a Language
+	DescriptionTranslated string
+	GUID                  string // the feed's own identifier for the item, if any
+	Hash                  string `gorm:"uniqueIndex"` // see itemKey
+	BreakingNewsScore     int
+	BreakingNewsReason    string
+	PublishedParsed       *time.Time  `gorm:"index"`
+	TimestampSource       string      // where PublishedParsed came from: TimestampPublished, TimestampUpdated or TimestampFirstSeen
+	ClusterID             uint        `gorm:"index"` // items about the same story share a ClusterID (0 = not clustered yet)
+	RevisedAt             *time.Time  // set when the publisher changed the title or description, see Revision
+	ExtractedAt           *time.Time  // set when full text extraction was tried
+	ArticleText           string      // text of the linked article if the extraction succeeded, paragraphs separated by ParagraphSep
+	ImageUrl              string      // lead image
+	Authors               string      // comma-separated names
+	Enclosures            []Enclosure `gorm:"foreignKey:ItemID"`
+	Categories            []Category  `gorm:"foreignKey:ItemID"`
+	Event                 string      `gorm:"-"` // EventNew or EventUpdated, for the ticker
 }
 
 /*** UPDATE FEEDS ***/
 
-// LoadFeedsIntoDB loads the feed list from the DB, then calls ingestFromUrlWriteToDB (concurrently) to load all feed items and write them to the DB (skipping duplicates).
-func UpdateFeeds() error {
+// UpdateFeeds loads the feed list from the DB, then calls ingestFromUrlWriteToDB (concurrently) to load all feed items and write them to the DB (skipping duplicates).
+// Cancelling ctx aborts the update.
+func UpdateFeeds(ctx context.Context) error {
 	var db *gorm.DB
 	if db = Config.DB; db == nil {
 		return ErrNoDBConnection
 	}
 	var feeds []Feed
-	var wg sync.WaitGroup
 
-	result := db.Find(&feeds)
+	result := db.Where("paused = ?", false).Find(&feeds)
 	if result.RowsAffected == 0 {
 		return errors.New("no feeds found")
 	}
 	if result.Error != nil {
 		return result.Error
 	}
-	for _, f := range feeds {
-		wg.Add(1)
-		feed := f //  If you create a closure inside a loop and this closure accesses the loop variable, it doesn't capture the value of the loop variable at the moment the closure is created. Instead, it captures the variable itself. Solution: reassign to a new variable.
-		go func() {
-			defer wg.Done()
-			ingestFromUrlWriteToDB(db, feed.Url, feed.Abbr)
-		}()
-	}
-	wg.Wait()
+	updateFeedList(ctx, db, feeds)
 	return nil
 }
 
-// goroutine called by ingestFromDB. Loads all items of a given feed (from url) and writes them to the DB if they're new.
-func ingestFromUrlWriteToDB(db *gorm.DB, u string, abbr string) {
-	fp := gofeed.NewParser()
-	feed, err := fp.ParseURL(u)
-	if err != nil {
-		return
+// UpdateDueFeeds fetches only those feeds whose next scheduled fetch is due and returns the number of new items found,
+// including those that were pushed since the last call.
+// Cancelling ctx aborts the update.
+func UpdateDueFeeds(ctx context.Context) (int, error) {
+	var db *gorm.DB
+	if db = Config.DB; db == nil {
+		return 0, ErrNoDBConnection
 	}
+	var feeds []Feed
+	result := db.Where("paused = ?", false).Where("next_fetch IS NULL OR next_fetch <= ?", time.Now()).Find(&feeds)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return updateFeedList(ctx, db, feeds) + int(pushedItems.Swap(0)), nil
+}
+
+// ingestFromUrlWriteToDB is run by the workers of updateFeedList. Loads all items of a given feed (from url) and writes them to the DB if they're new.
+// Returns the number of new items.
+func ingestFromUrlWriteToDB(ctx context.Context, db *gorm.DB, f Feed) int {
+	var newItems int
+	feed, err := fetchFeed(ctx, &f)
+	if err != nil && ctx.Err() != nil {
+		// shutting down - don't count this as a failure of the feed
+		log.Printf("Fetching %v cancelled.", f.Name)
+		return 0
+	}
+	if err == nil {
+		newItems = writeItemsToDB(db, feed, f.Abbr, f.Location())
+	}
+	recordFetchResult(db, &f, err, newItems)
+	if errors.Is(err, ErrNotModified) {
+		log.Printf("%s not modified, skipping.", f.Name)
+	} else if err != nil {
+		log.Printf("Error fetching feed %v: %v", f.Name, err)
+	}
+	return newItems
+}
+
+// writeItemsToDB writes the items of a parsed feed to the DB (skipping duplicates), tagged with abbr, and streams new items to the ticker channel.
+// Known items whose title or description changed are revised (see reviseItem) and streamed as EventUpdated.
+// Dates without a time zone are read in loc (nil: as UTC). Returns the number of new and revised items.
+func writeItemsToDB(db *gorm.DB, feed *gofeed.Feed, abbr string, loc *time.Location) int {
+	var newItems int
 	log.Printf("Updating %s.", feed.Title)
 	for _, item := range feed.Items {
-		// this is our way of avoiding duplicates. We hash the link and then check the DB for this hash.
-		// It's a unique key, so trying to insert a duplicate will throw an error. Hence we use gorm's "First or create", which is roughly the same as "INSERT IGNORE"
-		hash := sha1.Sum([]byte(item.Link))
-		hashBase64 := base64.StdEncoding.EncodeToString(hash[:])
-		if item.PublishedParsed == nil || item.PublishedParsed.IsZero() {
-			log.Printf("Publish date not parsed for item %v in feed %v.", item.Title, feed.Title)
+		// this is our way of avoiding duplicates. We hash the GUID or canonical link and then check the DB for this hash.
+		// It's a unique key, so trying to insert a duplicate will throw an error. Known items of this feed are checked for revisions instead.
+		hashBase64, feedHashes, globalHashes := itemHashes(item, abbr)
+		published, source := itemTimestamp(item, loc, time.Now())
+		if source != TimestampPublished {
+			log.Printf("Publish date not parsed for item %v in feed %v, using %v date.", item.Title, feed.Title, source)
 			log.Printf("Published: %v, PublishedParsed: %v, Updated: %v, UpdatedParsed: %v", item.Published, item.PublishedParsed, item.Updated, item.UpdatedParsed)
-			continue
 		}
 
 		// some feeds produce days in the future - check and fix
-		if item.PublishedParsed.After(time.Now()) {
-			log.Printf("Fixing publish date for feed %v. (Published: %v Parsed as: %v) Item: %v", feed.Title, item.Published, item.PublishedParsed, item.Title)
+		if published.After(time.Now()) {
+			log.Printf("Fixing publish date for feed %v. (Published: %v Parsed as: %v) Item: %v", feed.Title, item.Published, published, item.Title)
 			now := time.Now()
-			item.PublishedParsed = &now
+			published = &now
 		}
 
 		// fix for empty "description" field
 		var preview string
 		if item.Description != "" {
-			preview = stripHTML(item.Description)
+			preview = HTMLToText(item.Description)
 		} else {
-			preview = stripHTML(item.Content)
+			preview = HTMLToText(item.Content)
 		}
 		// shorten description to 450 chars
 		if utf8.RuneCountInString(preview) > 450 {
 			runes := []rune(preview)
 			preview = string(runes[:450]) + "..."
 		}
-		dbItem := Item{Title: item.Title, FeedAbbr: abbr, Link: item.Link, Description: preview, Content: item.Content, Hash: hashBase64, PublishedParsed: item.PublishedParsed}
-		result := db.Where(Item{Hash: hashBase64}).FirstOrCreate(&dbItem)
-		if result.Error != nil {
+		// items stored before canonical hashing (and not yet migrated) are known under a legacy hash
+		var known []Item
+		if result := db.Where("hash IN ? OR (feed_abbr = ? AND hash IN ?)", globalHashes, abbr, feedHashes).Find(&known); result.Error != nil {
 			log.Printf("Error updating feed %v: %v", feed.Title, result.Error)
 			continue
 		}
-		// detect if the item was newly created
-		if result.RowsAffected > 0 {
-			// item is new, stream to channel if it has been set
-			if Config.TickerChannel != nil {
-				// check if channel is blocked
-				select {
-				case Config.TickerChannel <- dbItem:
-				default:
-					log.Println("Ticker channel blocked, skipping item.")
-				}
+		var existing Item
+		for _, k := range known {
+			if k.FeedAbbr == abbr {
+				existing = k
+				break
 			}
 		}
+		content := SanitizeHTML(item.Content)
+		image, authors, enclosures, categories := itemMedia(item)
+		dbItem := Item{Title: item.Title, FeedAbbr: abbr, Link: item.Link, Description: preview, Content: content, GUID: item.GUID, Hash: hashBase64, PublishedParsed: published, TimestampSource: source,
+			ImageUrl: image, Authors: authors, Enclosures: enclosures, Categories: categories, Event: EventNew}
+		if existing.ID == 0 && len(known) > 0 {
+			// another feed carries the same article; it stays with the feed that stored it first
+			continue
+		} else if existing.ID == 0 && !retained(db, abbr, *published) {
+			// PruneItems would delete it again (and it may have done so already, taking the hash with it)
+			continue
+		} else if existing.ID != 0 {
+			revised, err := reviseItem(db, &existing, item.Title, preview, content)
+			if err != nil {
+				log.Printf("Error revising item %v: %v", existing.ID, err)
+			}
+			if !revised {
+				continue
+			}
+			existing.ImageUrl, existing.Authors = image, authors
+			if result := db.Model(&existing).Select("image_url", "authors").Updates(&existing); result.Error != nil {
+				log.Printf("Error revising item %v: %v", existing.ID, result.Error)
+			}
+			if err := replaceItemMedia(db, existing.ID, enclosures, categories); err != nil {
+				log.Printf("Error revising item %v: %v", existing.ID, err)
+			}
+			existing.Enclosures, existing.Categories = enclosures, categories
+			dbItem = existing
+			dbItem.Event = EventUpdated
+		} else if result := db.Create(&dbItem); result.Error != nil {
+			// most likely another feed stored the same item in the meantime
+			log.Printf("Error updating feed %v: %v", feed.Title, result.Error)
+			continue
+		}
+		newItems++
+		// stream to channel if it has been set
+		if Config.TickerChannel != nil {
+			// check if channel is blocked
+			select {
+			case Config.TickerChannel <- dbItem:
+			default:
+				log.Println("Ticker channel blocked, skipping item.")
+			}
+		}
+	}
+	return newItems
+}
+
+// recordFetchResult updates the health fields of f according to err (a 304 counts as success), schedules the next fetch
+// and saves them, together with the conditional GET validators (also those of sitemaps) and a changed WebSub hub.
+func recordFetchResult(db *gorm.DB, f *Feed, err error, newItems int) {
+	now := time.Now()
+	f.LastAttempt = &now
+	if err == nil || errors.Is(err, ErrNotModified) {
+		f.LastSuccess = &now
+		f.ConsecutiveFailures = 0
+		f.LastError = ""
+	} else {
+		f.ConsecutiveFailures++
+		f.LastError = err.Error()
+		if f.Failing() {
+			log.Printf("Feed %v has failed %d times in a row (%v).", f.Name, f.ConsecutiveFailures, err)
+		}
+	}
+	f.scheduleNext(now, newItems)
+	columns := []string{"ETag", "LastModified", "SitemapValidators", "LastAttempt", "LastSuccess", "ConsecutiveFailures", "LastStatus", "LastError", "CurrentInterval", "NextFetch"}
+	if f.hubChanged {
+		// the push state is otherwise left to SyncWebSub and the hub's callbacks, which may have changed it during the fetch
+		columns = append(columns, "HubUrl", "TopicUrl", "PushState", "PushExpires")
+	}
+	result := db.Model(f).Select(columns).Updates(f)
+	if result.Error != nil {
+		log.Printf("Error saving fetch status for feed %v: %v", f.Name, result.Error)
 	}
 }
 
@@ -171,6 +346,26 @@ func AllFeeds() ([]Feed, error) {
 	return feeds, result.Error
 }
 
+func FeedById(id uint) (Feed, error) {
+	if Config.DB == nil {
+		return Feed{}, ErrNoDBConnection
+	}
+	var feed Feed
+	result := Config.DB.First(&feed, id)
+	return feed, result.Error
+}
+
+func FeedUrlExists(u string) bool {
+	feeds, err := AllFeeds()
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	return slices.ContainsFunc(feeds, func(elem Feed) bool {
+		return elem.Url == u
+	})
+}
+
 func FeedExists(s string) bool {
 	feeds, err := AllFeeds()
 	if err != nil {
@@ -184,6 +379,12 @@ func FeedExists(s string) bool {
 
 // Get items from database. Filter may be "", timestamp may be 0 for all items
 func Items(filter string, search string, limit int, offset int, timestamp int64) ([]Item, error) {
+	return QueryItems(ItemQuery{Feed: filter, Search: search}, limit, offset, timestamp)
+}
+
+// QueryItems gets the items matching q from the database, newest first (best matches first for full-text searches).
+// Timestamp may be 0 for all items.
+func QueryItems(q ItemQuery, limit int, offset int, timestamp int64) ([]Item, error) {
 	var headlines []Item
 	var db *gorm.DB
 	if db = Config.DB; db == nil {
@@ -198,30 +399,76 @@ func Items(filter string, search string, limit int, offset int, timestamp int64)
 		startTime = time.Unix(timestamp, 0)
 	}
 
-	var result *gorm.DB
+	query := db.Table("items").Select("items.*").Where("items.published_parsed <= ?", startTime)
+	order := "items.published_parsed desc"
+	if q.Feed != "" {
+		query = query.Where("items.feed_abbr = ?", q.Feed)
+	}
+	if q.After != nil {
+		query = query.Where("items.published_parsed >= ?", *q.After)
+	}
+	if q.Before != nil {
+		query = query.Where("items.published_parsed < ?", *q.Before)
+	}
+	if q.MinScore != nil {
+		query = query.Where("items.breaking_news_score >= ?", *q.MinScore)
+	}
+	if q.MaxScore != nil {
+		query = query.Where("items.breaking_news_score <= ?", *q.MaxScore)
+	}
+	if q.Category != "" {
+		query = query.Where("items.id IN (SELECT item_id FROM categories WHERE name = ? COLLATE NOCASE)", q.Category)
+	}
+	if q.SavedBy != "" {
+		query = query.Where("items.id IN (SELECT item_id FROM "+savedItemsTable+" JOIN users ON users.id = "+savedItemsTable+".user_id WHERE users.user_name = ?)", q.SavedBy)
+	}
 
-	if filter == "" && search == "" {
-		// simple search, no filters or search terms
-		result = db.Limit(limit).Offset(offset).Order("published_parsed desc").Find(&headlines, "published_parsed <= ?", startTime)
+	if Config.FullTextSearch {
+		if q.Search != "" {
+			// full-text search, best matches first
+			match := ftsQuery(q.Search)
+			if match == "" {
+				return headlines, nil
+			}
+			query = query.Joins("JOIN items_fts ON items_fts.rowid = items.id").Where("items_fts MATCH ?", match)
+			order = "items_fts.rank, " + order
+		}
+		for _, term := range q.Exclude {
+			if match := ftsQuery(term); match != "" {
+				query = query.Where("items.id NOT IN (SELECT rowid FROM items_fts WHERE items_fts MATCH ?)", match)
+			}
+		}
 	} else {
-		// if no filter string is supplied, use wildcard
-		if filter == "" {
-			filter = "%"
+		if q.Search != "" {
+			pattern := likePattern(q.Search)
+			query = query.Where(`(items.title LIKE ? ESCAPE '\' OR items.description LIKE ? ESCAPE '\')`, pattern, pattern)
 		}
-		if search == "" {
-			search = "%"
-		} else {
-			search = "%" + search + "%"
+		for _, term := range q.Exclude {
+			pattern := likePattern(term)
+			// items without a description are kept
+			query = query.Where(`COALESCE(items.title, '') NOT LIKE ? ESCAPE '\' AND COALESCE(items.description, '') NOT LIKE ? ESCAPE '\'`, pattern, pattern)
 		}
-		result = db.Limit(limit).Offset(offset).Order("published_parsed desc").Find(&headlines, "feed_abbr LIKE ? AND title LIKE ? AND published_parsed <= ?", filter, search, startTime)
-
 	}
+
+	result := query.Preload("Enclosures").Preload("Categories").Limit(limit).Offset(offset).Order(order).Find(&headlines)
 	if result.Error != nil {
 		return nil, result.Error
 	}
 	return headlines, nil
 }
 
+// UntranslatedItems returns up to limit of the newest items of the feed abbr that have not been translated yet. Items without
+// a title are left out, as their translation would be empty as well.
+func UntranslatedItems(abbr string, limit int) ([]Item, error) {
+	var items []Item
+	var db *gorm.DB
+	if db = Config.DB; db == nil {
+		return nil, ErrNoDBConnection
+	}
+	result := db.Where("feed_abbr = ? AND title <> '' AND (title_translated = '' OR title_translated IS NULL)", abbr).Order("published_parsed desc").Limit(limit).Find(&items)
+	return items, result.Error
+}
+
 func UnscoredHeadlines() ([]Item, error) {
 	var headlines []Item
 	var db *gorm.DB
@@ -300,14 +547,41 @@ func SaveItem(i Item) error {
 	return result.Error
 }
 
-func SaveFeed(f Feed) error {
+// SaveTranslation stores the translated title and description of an item (leaving all other fields alone).
+func SaveTranslation(id uint, title string, description string) error {
 	if Config.DB == nil {
 		return ErrNoDBConnection
 	}
-	result := Config.DB.Save(&f)
+	result := Config.DB.Model(&Item{ID: id}).Updates(map[string]interface{}{"title_translated": title, "description_translated": description})
 	return result.Error
 }
 
+// SaveFeed saves the given columns (field names) of an existing feed. The others, such as the fetch state that a poll may
+// have updated in the meantime, are left alone. If its abbreviation changed, the items tagged with the old abbreviation are renamed too.
+func SaveFeed(f Feed, columns ...string) error {
+	if Config.DB == nil {
+		return ErrNoDBConnection
+	}
+	return Config.DB.Transaction(func(tx *gorm.DB) error {
+		var old Feed
+		if result := tx.First(&old, f.ID); result.Error != nil {
+			return result.Error
+		}
+		if result := tx.Model(&f).Select(columns).Updates(&f); result.Error != nil {
+			return result.Error
+		}
+		if old.Abbr != f.Abbr {
+			result := tx.Model(&Item{}).Where("feed_abbr = ?", old.Abbr).Update("feed_abbr", f.Abbr)
+			if result.Error != nil {
+				return result.Error
+			}
+			log.Printf("Renamed %d items from %v to %v.", result.RowsAffected, old.Abbr, f.Abbr)
+			return rehashFeedItems(tx, f.Abbr)
+		}
+		return nil
+	})
+}
+
 /* DELETE */
 
 func DeleteFeed(f Feed) error {
@@ -325,10 +599,3 @@ func DeleteFeedById(id uint) error {
 	result := Config.DB.Delete(&Feed{}, id)
 	return result.Error
 }
-
-// HELPERS
-
-func stripHTML(s string) string {
-	re := regexp.MustCompile("<[^>]*>")
-	return re.ReplaceAllString(s, "")
-}
@@ -0,0 +1,134 @@
+package feeds
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/mmcdole/gofeed"
+)
+
+const maxFeedBytes = 20 << 20 // larger responses are rejected
+
+var ErrFeedTooLarge = fmt.Errorf("response larger than %d MB", maxFeedBytes>>20)
+
+// fetchFeed downloads and parses the feed at f.Url. The validators stored on f (ETag, Last-Modified) are sent along,
+// so a server that supports conditional GET can answer 304 - in that case ErrNotModified is returned and nothing is parsed.
+// On success, f.ETag and f.LastModified are set to the values returned by the server. f.LastStatus is set to the
+// HTTP status code of the response (0 if there was none), and f.HubUrl and f.TopicUrl to the WebSub hub the feed advertises.
+// The request (including parsing) is aborted when ctx is done or the configured fetch timeout has passed; requests to the same
+// host are spaced out by the configured host delay. Mail sources are read from their mailbox instead, see readMailbox.
+func fetchFeed(ctx context.Context, f *Feed) (*gofeed.Feed, error) {
+	switch f.Type {
+	case TypeMail:
+		return readMailbox(f)
+	case TypeAPI:
+		// items are submitted, there is nothing to fetch
+		return nil, ErrNotModified
+	}
+	f.LastStatus = 0
+	_, timeout, hostDelay, userAgent := Config.fetcherSettings()
+	if err := hosts.wait(ctx, feedHost(f.Url), hostDelay); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.Url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	if err := f.applyRequestOptions(req); err != nil {
+		return nil, err
+	}
+	if f.ETag != "" {
+		req.Header.Set("If-None-Match", f.ETag)
+	}
+	if f.LastModified != "" {
+		req.Header.Set("If-Modified-Since", f.LastModified)
+	}
+
+	client, release, err := f.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	f.LastStatus = resp.StatusCode
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, ErrNotModified
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, gofeed.HTTPError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+		}
+	}
+
+	// reading the body is bound to ctx as well
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFeedBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxFeedBytes {
+		return nil, ErrFeedTooLarge
+	}
+	feed, err := parseSource(ctx, f, bytes.NewReader(body), resp.Request.URL)
+	if err != nil {
+		return nil, err
+	}
+	if f.Type == TypeRSS {
+		f.setHub(discoverHub(resp.Header, body))
+	}
+	f.ETag = resp.Header.Get("ETag")
+	f.LastModified = resp.Header.Get("Last-Modified")
+	return feed, nil
+}
+
+// Source types, see Feed.Type.
+const (
+	TypeRSS     = ""        // RSS, Atom or JSON feed
+	TypeScrape  = "scrape"  // HTML page read with CSS selectors, see ScrapeSelectors
+	TypeMail    = "mail"    // email newsletters, see ValidateMailboxUrl
+	TypeAPI     = "api"     // items submitted by scripts, see IngestItems
+	TypeSitemap = "sitemap" // Google News sitemap or sitemap index, see readSitemap
+)
+
+// parseSource turns the response body for f into a gofeed.Feed according to the feed's type, so all source types share
+// the same ingest path (writeItemsToDB). base is the URL the body was fetched from; ctx bounds further requests (see readSitemap).
+func parseSource(ctx context.Context, f *Feed, body io.Reader, base *url.URL) (*gofeed.Feed, error) {
+	switch f.Type {
+	case TypeRSS:
+		return gofeed.NewParser().Parse(body)
+	case TypeScrape:
+		return scrapePage(body, base, f.Scrape)
+	case TypeSitemap:
+		return readSitemap(ctx, f, body, base)
+	default:
+		return nil, fmt.Errorf("unknown source type '%s'", f.Type)
+	}
+}
+
+// PreviewSource fetches a source that is not a regular feed (see PreviewFeed for those) with its settings
+// and returns a preview of its latest items.
+func PreviewSource(ctx context.Context, f Feed) (*FeedPreview, error) {
+	f.ETag, f.LastModified = "", ""
+	feed, err := fetchFeed(ctx, &f)
+	if errors.Is(err, ErrNotModified) {
+		// an empty mailbox, or a source that items are delivered to
+		feed, err = &gofeed.Feed{Title: f.Name}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newPreview(feed, f.Url), nil
+}
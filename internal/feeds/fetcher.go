@@ -0,0 +1,146 @@
+package feeds
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultWorkers      = 8
+	DefaultFetchTimeout = 30 * time.Second
+	DefaultHostDelay    = 2 * time.Second
+	DefaultUserAgent    = "Mozilla/5.0 (compatible; Reader/1.0; +https://github.com/signalstoerung/reader)"
+)
+
+// SetFetcher configures the feed fetcher: the number of feeds fetched in parallel, the timeout per request, the minimum time
+// between two requests to the same host and the User-Agent header. Zero values (or "") select the defaults, see fetcherSettings.
+func (c *Configuration) SetFetcher(workers int, timeout time.Duration, hostDelay time.Duration, userAgent string) {
+	c.Workers, c.FetchTimeout, c.HostDelay, c.UserAgent = workers, timeout, hostDelay, userAgent
+}
+
+// fetcherSettings returns the fetcher configuration, with the Default* values for anything that hasn't been set.
+func (c *Configuration) fetcherSettings() (workers int, timeout time.Duration, hostDelay time.Duration, userAgent string) {
+	workers, timeout, hostDelay, userAgent = c.Workers, c.FetchTimeout, c.HostDelay, c.UserAgent
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	if timeout <= 0 {
+		timeout = DefaultFetchTimeout
+	}
+	if hostDelay <= 0 {
+		hostDelay = DefaultHostDelay
+	}
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	return
+}
+
+// hostLimiter spaces out requests to the same host, so publishers with several feeds on one domain aren't hit all at once.
+type hostLimiter struct {
+	mu   sync.Mutex
+	next map[string]time.Time // earliest time the next request to a host may start
+}
+
+var hosts = hostLimiter{next: make(map[string]time.Time)}
+
+// wait reserves the next slot for host and blocks until it has come, or until ctx is done (returning its error).
+func (l *hostLimiter) wait(ctx context.Context, host string, delay time.Duration) error {
+	if host == "" {
+		return ctx.Err()
+	}
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next[host] = slot.Add(delay)
+	// forget hosts that haven't been requested for a while
+	for h, t := range l.next {
+		if t.Before(now.Add(-time.Hour)) {
+			delete(l.next, h)
+		}
+	}
+	l.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(slot))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// feedHost returns the lower-case host of a feed URL, or "" if it can't be parsed.
+func feedHost(feedUrl string) string {
+	u, err := url.Parse(feedUrl)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// interleaveByHost orders feeds so that feeds on the same host are spread out, which keeps workers from queueing up behind
+// the host limiter while other hosts are waiting.
+func interleaveByHost(feeds []Feed) []Feed {
+	byHost := make(map[string][]Feed)
+	var order []string
+	for _, f := range feeds {
+		h := feedHost(f.Url)
+		if _, ok := byHost[h]; !ok {
+			order = append(order, h)
+		}
+		byHost[h] = append(byHost[h], f)
+	}
+	result := make([]Feed, 0, len(feeds))
+	for len(result) < len(feeds) {
+		for _, h := range order {
+			if list := byHost[h]; len(list) > 0 {
+				result = append(result, list[0])
+				byHost[h] = list[1:]
+			}
+		}
+	}
+	return result
+}
+
+// updateFeedList fetches feeds with a pool of Config.Workers workers and returns the total number of new items.
+// When ctx is cancelled, fetches in progress are aborted and the remaining feeds are skipped.
+func updateFeedList(ctx context.Context, db *gorm.DB, feeds []Feed) int {
+	workers, _, _, _ := Config.fetcherSettings()
+	jobs := make(chan Feed)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	total := 0
+	for i := 0; i < workers && i < len(feeds); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for feed := range jobs {
+				n := ingestFromUrlWriteToDB(ctx, db, feed)
+				mu.Lock()
+				total += n
+				mu.Unlock()
+			}
+		}()
+	}
+queue:
+	for _, f := range interleaveByHost(feeds) {
+		select {
+		case jobs <- f:
+		case <-ctx.Done():
+			break queue
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return total
+}
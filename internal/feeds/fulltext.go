@@ -0,0 +1,234 @@
+package feeds
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+	"gorm.io/gorm"
+)
+
+const (
+	fullTextBatch     = 20             // articles fetched per call of ExtractFullText
+	fullTextMaxAge    = 24 * time.Hour // older items are left alone
+	fullTextMaxBytes  = 5 << 20        // articles larger than this are not read completely
+	minParagraphRunes = 25             // shorter paragraphs don't count towards a candidate's score
+	minArticleRunes   = 250            // extractions shorter than this are treated as failures
+	ParagraphSep      = "\n\n"         // separates the paragraphs of Item.ArticleText
+)
+
+var (
+	ErrNoArticleText = errors.New("no article text found")
+
+	// class and id hints, as used by readability
+	positiveHint = regexp.MustCompile(`(?i)article|body|content|entry|main|post|story|text|blog`)
+	negativeHint = regexp.MustCompile(`(?i)comment|share|social|related|promo|sidebar|footer|header|nav|menu|banner|advert|\bads?\b|newsletter|cookie|consent|subscribe|paywall|popup|modal|caption|byline|breadcrumb|tags`)
+)
+
+// ExtractFullText downloads the linked articles of new items from feeds with FullText set and stores the extracted article
+// text in Item.ArticleText. Every item is tried once; returns the number of articles extracted.
+func ExtractFullText(ctx context.Context) (int, error) {
+	var db *gorm.DB
+	if db = Config.DB; db == nil {
+		return 0, ErrNoDBConnection
+	}
+	var fullTextFeeds []Feed
+	if result := db.Where("full_text = ? AND paused = ?", true, false).Find(&fullTextFeeds); result.Error != nil {
+		return 0, result.Error
+	}
+	if len(fullTextFeeds) == 0 {
+		return 0, nil
+	}
+	byAbbr := make(map[string]Feed, len(fullTextFeeds))
+	abbrs := make([]string, 0, len(fullTextFeeds))
+	for _, f := range fullTextFeeds {
+		byAbbr[f.Abbr] = f
+		abbrs = append(abbrs, f.Abbr)
+	}
+	var items []Item
+	result := db.Where("feed_abbr IN ? AND extracted_at IS NULL AND created_at > ?", abbrs, time.Now().Add(-fullTextMaxAge)).
+		Order("published_parsed desc").Limit(fullTextBatch).Find(&items)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	extracted := 0
+	for _, item := range items {
+		if ctx.Err() != nil {
+			break
+		}
+		text, err := fetchArticleText(ctx, byAbbr[item.FeedAbbr], item.Link)
+		now := time.Now()
+		updates := map[string]interface{}{"extracted_at": &now}
+		if err != nil {
+			log.Printf("Full text extraction failed for %v: %v", item.Link, err)
+		} else {
+			updates["article_text"] = text
+			extracted++
+		}
+		if result := db.Model(&Item{ID: item.ID}).Updates(updates); result.Error != nil {
+			return extracted, result.Error
+		}
+	}
+	return extracted, nil
+}
+
+// fetchArticleText downloads the article at link with the fetcher settings of f and extracts its text. The feed's request
+// options are only sent if the article is on the same host as the feed.
+func fetchArticleText(ctx context.Context, f Feed, link string) (string, error) {
+	_, timeout, hostDelay, userAgent := Config.fetcherSettings()
+	host := feedHost(link)
+	if err := hosts.wait(ctx, host, hostDelay); err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	client, release := http.DefaultClient, func() {}
+	if host == feedHost(f.Url) {
+		if err := f.applyRequestOptions(req); err != nil {
+			return "", err
+		}
+		if client, release, err = f.httpClient(); err != nil {
+			return "", err
+		}
+	}
+	defer release()
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", errors.New(resp.Status)
+	}
+	return extractArticle(io.LimitReader(resp.Body, fullTextMaxBytes))
+}
+
+// extractArticle finds the main content of an HTML page in the way of readability: paragraphs award points to their parent
+// (and half to their grandparent) according to their length and number of commas, class names and ids hint at content or
+// clutter, and the text of the best scoring element is returned, one paragraph per block separated by ParagraphSep.
+func extractArticle(r io.Reader) (string, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return "", err
+	}
+	doc.Find("script, style, noscript, template, iframe, svg, form, nav, header, footer, aside, button, figure").Remove()
+	doc.Find("[class], [id]").Each(func(i int, s *goquery.Selection) {
+		if goquery.NodeName(s) == "body" || goquery.NodeName(s) == "article" || goquery.NodeName(s) == "main" {
+			return
+		}
+		hint := s.AttrOr("class", "") + " " + s.AttrOr("id", "")
+		if negativeHint.MatchString(hint) && !positiveHint.MatchString(hint) {
+			s.Remove()
+		}
+	})
+
+	type candidate struct {
+		sel   *goquery.Selection
+		score float64
+	}
+	candidates := make(map[*html.Node]*candidate)
+	var order []*html.Node // map iteration order is random, keep ties stable
+	award := func(s *goquery.Selection, points float64) {
+		if s.Length() == 0 {
+			return
+		}
+		node := s.Get(0)
+		c, ok := candidates[node]
+		if !ok {
+			c = &candidate{sel: s, score: classWeight(s)}
+			candidates[node] = c
+			order = append(order, node)
+		}
+		c.score += points
+	}
+	doc.Find("p, pre, td").Each(func(i int, p *goquery.Selection) {
+		text := strings.TrimSpace(p.Text())
+		length := utf8.RuneCountInString(text)
+		if length < minParagraphRunes {
+			return
+		}
+		points := 1 + float64(strings.Count(text, ",")) + float64(min(length/100, 3))
+		award(p.Parent(), points)
+		award(p.Parent().Parent(), points/2)
+	})
+
+	var best *goquery.Selection
+	var bestScore float64
+	for _, node := range order {
+		c := candidates[node]
+		// prefer elements that are mostly text over link lists
+		score := c.score * (1 - linkDensity(c.sel))
+		if best == nil || score > bestScore {
+			best, bestScore = c.sel, score
+		}
+	}
+	if best == nil {
+		return "", ErrNoArticleText
+	}
+
+	var paragraphs []string
+	best.Find("p, h2, h3, h4, li, blockquote, pre").Each(func(i int, s *goquery.Selection) {
+		// nested blocks are covered by their parent
+		if s.ParentsFiltered("p, li, blockquote, pre").Length() > 0 {
+			return
+		}
+		if text := strings.Join(strings.Fields(s.Text()), " "); text != "" {
+			paragraphs = append(paragraphs, text)
+		}
+	})
+	text := strings.Join(paragraphs, ParagraphSep)
+	if utf8.RuneCountInString(text) < minArticleRunes {
+		return "", ErrNoArticleText
+	}
+	return text, nil
+}
+
+// classWeight is the initial score of an element, based on its class and id.
+func classWeight(s *goquery.Selection) float64 {
+	var weight float64
+	for _, hint := range []string{s.AttrOr("class", ""), s.AttrOr("id", "")} {
+		if hint == "" {
+			continue
+		}
+		if positiveHint.MatchString(hint) {
+			weight += 25
+		}
+		if negativeHint.MatchString(hint) {
+			weight -= 25
+		}
+	}
+	switch goquery.NodeName(s) {
+	case "article", "main":
+		weight += 10
+	case "div":
+		weight += 5
+	}
+	return weight
+}
+
+// linkDensity returns the share of the text of s that is inside links.
+func linkDensity(s *goquery.Selection) float64 {
+	total := utf8.RuneCountInString(strings.TrimSpace(s.Text()))
+	if total == 0 {
+		return 0
+	}
+	links := 0
+	s.Find("a").Each(func(i int, a *goquery.Selection) {
+		links += utf8.RuneCountInString(strings.TrimSpace(a.Text()))
+	})
+	return float64(links) / float64(total)
+}
@@ -0,0 +1,467 @@
+package feeds
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mmcdole/gofeed"
+	"golang.org/x/net/html/charset"
+)
+
+// Mailbox schemes of TypeMail sources. The Url of a mail source is "maildir:<dir>" or "mbox:<file>" with a path relative
+// to Config.MailboxDir, or "smtp:<name>" for messages that the built-in listener (see ListenSMTP) receives for <name>@<any domain>.
+const (
+	mailboxMaildir = "maildir"
+	mailboxMbox    = "mbox"
+	mailboxSMTP    = "smtp"
+)
+
+const (
+	maxMailboxMessages = 100             // messages read per poll; a new mailbox only contributes its latest messages
+	mboxSettle         = time.Minute     // the last message of an mbox file is read once the file hasn't changed for this long
+	maildirSettle      = 5 * time.Minute // a Maildir message may turn up this long after its modification time (see readMaildir)
+	maxMessageBytes    = 10 << 20        // larger messages are skipped (or refused by the listener)
+	maxMessageParts    = 50              // MIME parts looked at per message
+)
+
+var (
+	ErrNoMailboxDir   = errors.New("no mailbox directory configured")
+	ErrInvalidMailbox = errors.New("invalid mailbox (use maildir:<dir>, mbox:<file> or smtp:<name>)")
+
+	// viewInBrowser matches the text of "view in browser" links, in English, German and Dutch
+	viewInBrowser = regexp.MustCompile(`(?i)\b(view|read|open|see|display)\b[^.!?\n]{0,30}\b(in (your|a|the) (web ?)?browser|online|on (the|our) (web|website))\b|` +
+		`\bweb ?version\b|\bbrowser version\b|\bim browser\b|\bonline (ansehen|lesen|anzeigen)\b|\bwebversie\b|\bin je browser\b|` +
+		`\btrouble (viewing|reading)\b|\bnot (displaying|displayed) (correctly|properly)\b`)
+	textURL     = regexp.MustCompile(`https?://[^\s<>()"\[\]]+`)
+	mailboxName = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+	wordDecoder = &mime.WordDecoder{CharsetReader: charset.NewReaderLabel}
+)
+
+// SetMailboxDir sets the directory that the Maildir and mbox paths of mail sources are relative to. "" disables them.
+func (c *Configuration) SetMailboxDir(dir string) {
+	c.MailboxDir = dir
+}
+
+// IsMailboxUrl reports whether u is the address of a mail source rather than a web URL.
+func IsMailboxUrl(u string) bool {
+	scheme, _, found := strings.Cut(u, ":")
+	return found && (scheme == mailboxMaildir || scheme == mailboxMbox || scheme == mailboxSMTP)
+}
+
+// ValidateMailboxUrl checks the address of a mail source and returns it in normalized form.
+func ValidateMailboxUrl(u string) (string, error) {
+	scheme, name, _ := strings.Cut(strings.TrimSpace(u), ":")
+	switch scheme {
+	case mailboxMaildir, mailboxMbox:
+		if Config.MailboxDir == "" {
+			return "", ErrNoMailboxDir
+		}
+		name = filepath.Clean(name)
+		if !filepath.IsLocal(name) {
+			return "", fmt.Errorf("%w: the path must be inside the mailbox directory", ErrInvalidMailbox)
+		}
+	case mailboxSMTP:
+		name = strings.ToLower(name)
+		if !mailboxName.MatchString(name) {
+			return "", fmt.Errorf("%w: the name may only contain letters, digits, '.', '_' and '-'", ErrInvalidMailbox)
+		}
+	default:
+		return "", ErrInvalidMailbox
+	}
+	return scheme + ":" + name, nil
+}
+
+// readMailbox reads the messages that arrived in the mailbox of a mail source since the last poll. How far the mailbox
+// has been read is kept in f.ETag and f.LastModified: the byte offset and modification time of an mbox file, or the
+// modification time of the newest message in a Maildir. Returns ErrNotModified if there is nothing new, which is always
+// the case for smtp mailboxes, as their messages are delivered by the listener.
+func readMailbox(f *Feed) (*gofeed.Feed, error) {
+	f.LastStatus = 0
+	scheme, name, _ := strings.Cut(f.Url, ":")
+	feed := &gofeed.Feed{Title: f.Name, FeedType: TypeMail}
+	var err error
+	switch scheme {
+	case mailboxMaildir, mailboxMbox:
+		if Config.MailboxDir == "" {
+			return nil, ErrNoMailboxDir
+		}
+		path := filepath.Join(Config.MailboxDir, name)
+		if scheme == mailboxMaildir {
+			feed.Items, err = readMaildir(f, path)
+		} else {
+			feed.Items, err = readMbox(f, path)
+		}
+	case mailboxSMTP:
+		return nil, ErrNotModified
+	default:
+		return nil, ErrInvalidMailbox
+	}
+	if err != nil {
+		return nil, err
+	}
+	return feed, nil
+}
+
+// readMaildir parses the messages in the new and cur folders of a Maildir that are newer than f.LastModified.
+// A message is written to tmp and only then moved to new, so it may show up after messages with a later modification time;
+// f.LastModified therefore stays maildirSettle behind the time of reading, and messages read twice are recognized by their GUID.
+func readMaildir(f *Feed, dir string) ([]*gofeed.Item, error) {
+	since, _ := time.Parse(time.RFC3339Nano, f.LastModified)
+	type message struct {
+		path    string
+		modTime time.Time
+	}
+	var messages []message
+	for _, sub := range []string{"new", "cur"} {
+		entries, err := os.ReadDir(filepath.Join(dir, sub))
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if !e.Type().IsRegular() || strings.HasPrefix(e.Name(), ".") {
+				continue
+			}
+			info, err := e.Info()
+			if err != nil || !info.ModTime().After(since) {
+				continue
+			}
+			messages = append(messages, message{filepath.Join(dir, sub, e.Name()), info.ModTime()})
+		}
+	}
+	if len(messages) == 0 {
+		return nil, ErrNotModified
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].modTime.Before(messages[j].modTime) })
+	if n := len(messages); n > maxMailboxMessages && since.IsZero() {
+		messages = messages[n-maxMailboxMessages:]
+	} else if n > maxMailboxMessages {
+		// the rest follow with the next polls; messages with the same time can't be told apart by f.LastModified
+		last := maxMailboxMessages
+		for last < n && messages[last].modTime.Equal(messages[last-1].modTime) {
+			last++
+		}
+		messages = messages[:last]
+	}
+	cursor := messages[len(messages)-1].modTime
+	if settled := time.Now().Add(-maildirSettle); cursor.After(settled) {
+		cursor = settled
+	}
+	f.LastModified = cursor.Format(time.RFC3339Nano)
+
+	var items []*gofeed.Item
+	for _, m := range messages {
+		data, err := readMessageFile(m.path)
+		if err == nil {
+			var item *gofeed.Item
+			if item, err = parseMessage(bytes.NewReader(data)); err == nil {
+				items = append(items, item)
+				continue
+			}
+		}
+		log.Printf("Skipping message %v: %v", m.path, err)
+	}
+	return items, nil
+}
+
+// readMessageFile reads a message file, unless it is larger than maxMessageBytes.
+func readMessageFile(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxMessageBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxMessageBytes {
+		return nil, errors.New("message too large")
+	}
+	return data, nil
+}
+
+// readMbox parses the messages appended to an mbox file since the offset stored in f.ETag, at most maxMailboxMessages
+// (of a file read for the first time, the latest). The offset only moves past messages that were read, and past the last
+// message of the file once the file has stopped changing (see mboxSettle), as it may still be being written. If the file
+// has shrunk (e.g. it was compacted), it is read from the start again - messages seen before are recognized by their Message-ID.
+func readMbox(f *Feed, path string) ([]*gofeed.Item, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset, _ := strconv.ParseInt(f.ETag, 10, 64)
+	fresh := f.ETag == "" || offset > info.Size() || offset < 0
+	if fresh {
+		offset = 0
+	}
+	modTime := info.ModTime().Format(time.RFC3339Nano)
+	if offset == info.Size() && f.LastModified == modTime {
+		return nil, ErrNotModified
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var messages [][]byte
+	var current []byte
+	cursor := offset // start of the first message not read yet
+	keep := func(end int64) {
+		if len(bytes.TrimSpace(current)) > 0 && len(current) <= maxMessageBytes {
+			messages = append(messages, current)
+			if len(messages) > maxMailboxMessages {
+				messages = messages[1:]
+			}
+		}
+		current, cursor = nil, end
+	}
+	r := bufio.NewReader(file)
+	read := offset
+	blank := true // the first line starts a message
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			current = append(current, line...)
+			if time.Since(info.ModTime()) >= mboxSettle {
+				keep(read + int64(len(line)))
+			}
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		start := read
+		read += int64(len(line))
+		if blank && bytes.HasPrefix(line, []byte("From ")) {
+			if !fresh && len(messages) == maxMailboxMessages {
+				break // the rest follow with the next poll
+			}
+			// the separator line is not part of the message
+			keep(start)
+		} else if len(current) <= maxMessageBytes {
+			// mboxrd quoting: ">From " at the start of a line stands for "From ", ">>From " for ">From " and so on
+			if unquoted := bytes.TrimLeft(line, ">"); len(unquoted) < len(line) && bytes.HasPrefix(unquoted, []byte("From ")) {
+				line = line[1:]
+			}
+			current = append(current, line...)
+		}
+		blank = len(bytes.TrimRight(line, "\r\n")) == 0
+	}
+	f.ETag = strconv.FormatInt(cursor, 10)
+	f.LastModified = modTime
+
+	var items []*gofeed.Item
+	for _, m := range messages {
+		item, err := parseMessage(bytes.NewReader(m))
+		if err != nil {
+			log.Printf("Skipping message in %v: %v", path, err)
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// parseMessage turns an email message into a feed item: the subject is the title, the HTML body (or the plain text body,
+// converted to HTML) is the content and the "view in browser" link, if there is one, is the link. The Message-ID is used
+// as the GUID, so a message is only stored once however often it is read.
+func parseMessage(r io.Reader) (*gofeed.Item, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	item := &gofeed.Item{Title: strings.Join(strings.Fields(decodeHeader(msg.Header.Get("Subject"))), " ")}
+	if item.Title == "" {
+		item.Title = "(no subject)"
+	}
+	item.Published = msg.Header.Get("Date")
+	if date, err := msg.Header.Date(); err == nil {
+		item.PublishedParsed = &date
+	}
+	parser := mail.AddressParser{WordDecoder: wordDecoder}
+	if from, err := parser.Parse(msg.Header.Get("From")); err == nil {
+		name := from.Name
+		if name == "" {
+			name = from.Address
+		}
+		item.Authors = []*gofeed.Person{{Name: name, Email: from.Address}}
+	}
+	item.GUID = strings.Trim(strings.TrimSpace(msg.Header.Get("Message-Id")), "<>")
+	if item.GUID == "" {
+		item.GUID = "mail:" + hashString(msg.Header.Get("From")+"\n"+msg.Header.Get("Subject")+"\n"+item.Published)
+	}
+
+	var htmlBody, textBody string
+	parts := 0
+	if err := readBody(textproto.MIMEHeader(msg.Header), msg.Body, &htmlBody, &textBody, &parts); err != nil && htmlBody == "" && textBody == "" {
+		return nil, err
+	}
+	if htmlBody != "" {
+		item.Content = htmlBody
+		item.Link = htmlBrowserLink(htmlBody)
+	} else {
+		item.Content = textToHTML(textBody)
+	}
+	if item.Link == "" {
+		item.Link = textBrowserLink(textBody)
+	}
+	return item, nil
+}
+
+// decodeHeader decodes RFC 2047 encoded words in a header value; values that can't be decoded are returned as they are.
+func decodeHeader(s string) string {
+	decoded, err := wordDecoder.DecodeHeader(s)
+	if err != nil {
+		return s
+	}
+	return decoded
+}
+
+// readBody walks the MIME structure of a message body and keeps the first text/html and text/plain parts that aren't
+// attachments, decoded to UTF-8.
+func readBody(header textproto.MIMEHeader, body io.Reader, htmlBody *string, textBody *string, parts *int) error {
+	if *parts++; *parts > maxMessageParts {
+		return nil
+	}
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	if disposition, _, _ := mime.ParseMediaType(header.Get("Content-Disposition")); disposition == "attachment" {
+		return nil
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			// NextRawPart leaves the transfer encoding to us, like for single part messages
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := readBody(part.Header, part, htmlBody, textBody, parts); err != nil {
+				return err
+			}
+		}
+	}
+	if (mediaType == "text/html" && *htmlBody != "") || (mediaType == "text/plain" && *textBody != "") ||
+		(mediaType != "text/html" && mediaType != "text/plain") {
+		return nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(header.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	if label := params["charset"]; label != "" {
+		if body, err = charset.NewReaderLabel(label, body); err != nil {
+			return err
+		}
+	}
+	data, err := io.ReadAll(io.LimitReader(body, maxMessageBytes))
+	if err != nil {
+		return err
+	}
+	if mediaType == "text/html" {
+		*htmlBody = string(data)
+	} else {
+		*textBody = string(data)
+	}
+	return nil
+}
+
+// textToHTML turns a plain text body into HTML paragraphs.
+func textToHTML(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	var b strings.Builder
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		b.WriteString("<p>")
+		b.WriteString(strings.ReplaceAll(html.EscapeString(paragraph), "\n", "<br>"))
+		b.WriteString("</p>")
+	}
+	return b.String()
+}
+
+// htmlBrowserLink returns the target of the "view in browser" link of an HTML newsletter, or "". Short link texts
+// ("Click here") are judged by the text around them.
+func htmlBrowserLink(body string) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(body))
+	if err != nil {
+		return ""
+	}
+	var link string
+	doc.Find("a[href]").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		href := strings.TrimSpace(s.AttrOr("href", ""))
+		if !safeURL(href, "http", "https") {
+			return true
+		}
+		text := strings.Join(strings.Fields(s.Text()), " ")
+		if !viewInBrowser.MatchString(text) {
+			if len([]rune(text)) > 20 {
+				return true
+			}
+			around := []rune(strings.Join(strings.Fields(s.Parent().Text()), " "))
+			if len(around) > 200 || !viewInBrowser.MatchString(string(around)) {
+				return true
+			}
+		}
+		link = href
+		return false
+	})
+	return link
+}
+
+// textBrowserLink returns the URL on (or right after) the "view in browser" line of a plain text newsletter, or "".
+func textBrowserLink(body string) string {
+	lines := strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		if !viewInBrowser.MatchString(line) {
+			continue
+		}
+		if u := textURL.FindString(line); u != "" {
+			return strings.TrimRight(u, ".,;:!?'")
+		}
+		for _, next := range lines[i+1:] {
+			if next = strings.TrimSpace(next); next == "" {
+				continue
+			}
+			if u := textURL.FindString(next); u != "" && strings.Index(next, u) <= 1 {
+				return strings.TrimRight(u, ".,;:!?'")
+			}
+			break
+		}
+	}
+	return ""
+}
@@ -0,0 +1,148 @@
+package feeds
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+	"gorm.io/gorm"
+)
+
+const (
+	maxEnclosures = 10 // per item
+	maxCategories = 20
+)
+
+// Enclosure is a media file attached to an item, e.g. the audio of a podcast episode.
+type Enclosure struct {
+	ID     uint `gorm:"primaryKey"`
+	ItemID uint `gorm:"index"`
+	Url    string
+	Type   string // MIME type, e.g. audio/mpeg
+	Length int64  // in bytes, 0 if unknown
+}
+
+// IsAudio reports whether the enclosure is an audio file.
+func (e Enclosure) IsAudio() bool {
+	return strings.HasPrefix(e.Type, "audio/")
+}
+
+// IsVideo reports whether the enclosure is a video file.
+func (e Enclosure) IsVideo() bool {
+	return strings.HasPrefix(e.Type, "video/")
+}
+
+// Category is a category (or tag) the feed assigned to an item.
+type Category struct {
+	ID     uint   `gorm:"primaryKey"`
+	ItemID uint   `gorm:"index"`
+	Name   string `gorm:"index"`
+}
+
+// itemMedia returns the lead image, authors, enclosures and categories of a feed item.
+func itemMedia(item *gofeed.Item) (image string, authors string, enclosures []Enclosure, categories []Category) {
+	for _, e := range item.Enclosures {
+		if e == nil || !safeURL(e.URL, "http", "https") || len(enclosures) >= maxEnclosures {
+			continue
+		}
+		length, _ := strconv.ParseInt(strings.TrimSpace(e.Length), 10, 64)
+		enclosures = append(enclosures, Enclosure{Url: e.URL, Type: strings.ToLower(strings.TrimSpace(e.Type)), Length: length})
+	}
+
+	if item.Image != nil && safeURL(item.Image.URL, "http", "https") {
+		image = item.Image.URL
+	} else if image = mediaImage(item.Extensions); image == "" {
+		for _, e := range enclosures {
+			if strings.HasPrefix(e.Type, "image/") {
+				image = e.Url
+				break
+			}
+		}
+	}
+
+	var names []string
+	for _, p := range item.Authors {
+		if p != nil && strings.TrimSpace(p.Name) != "" {
+			names = append(names, strings.TrimSpace(p.Name))
+		}
+	}
+	authors = strings.Join(names, ", ")
+
+	seen := make(map[string]bool)
+	for _, c := range item.Categories {
+		name := strings.Join(strings.Fields(c), " ")
+		if name == "" || seen[strings.ToLower(name)] || len(categories) >= maxCategories {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		categories = append(categories, Category{Name: name})
+	}
+	return
+}
+
+// mediaImage returns the URL of the first image in the Media RSS extension (media:thumbnail, or media:content that is an
+// image, also inside media:group), or "".
+func mediaImage(extensions ext.Extensions) string {
+	media, ok := extensions["media"]
+	if !ok {
+		return ""
+	}
+	var elements []ext.Extension
+	elements = append(elements, media["thumbnail"]...)
+	elements = append(elements, media["content"]...)
+	for _, group := range media["group"] {
+		elements = append(elements, group.Children["thumbnail"]...)
+		elements = append(elements, group.Children["content"]...)
+	}
+	for _, e := range elements {
+		url := e.Attrs["url"]
+		if !safeURL(url, "http", "https") {
+			continue
+		}
+		if e.Name == "thumbnail" || e.Attrs["medium"] == "image" || strings.HasPrefix(e.Attrs["type"], "image/") {
+			return url
+		}
+	}
+	return ""
+}
+
+// replaceItemMedia replaces the enclosures and categories of an item.
+func replaceItemMedia(db *gorm.DB, itemID uint, enclosures []Enclosure, categories []Category) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Where("item_id = ?", itemID).Delete(&Enclosure{}); result.Error != nil {
+			return result.Error
+		}
+		if result := tx.Where("item_id = ?", itemID).Delete(&Category{}); result.Error != nil {
+			return result.Error
+		}
+		for i := range enclosures {
+			enclosures[i].ID, enclosures[i].ItemID = 0, itemID
+		}
+		for i := range categories {
+			categories[i].ID, categories[i].ItemID = 0, itemID
+		}
+		if len(enclosures) > 0 {
+			if result := tx.Create(&enclosures); result.Error != nil {
+				return result.Error
+			}
+		}
+		if len(categories) > 0 {
+			if result := tx.Create(&categories); result.Error != nil {
+				return result.Error
+			}
+		}
+		return nil
+	})
+}
+
+// AllCategories returns the names of all categories in use, most frequent first, up to limit.
+func AllCategories(limit int) ([]string, error) {
+	var db *gorm.DB
+	if db = Config.DB; db == nil {
+		return nil, ErrNoDBConnection
+	}
+	var names []string
+	result := db.Model(&Category{}).Select("name").Group("name COLLATE NOCASE").Order("COUNT(*) desc").Limit(limit).Pluck("name", &names)
+	return names, result.Error
+}
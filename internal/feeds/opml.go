@@ -0,0 +1,72 @@
+package feeds
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+// OPML is a minimal representation of an OPML 2.0 document, sufficient for exchanging subscription lists.
+type OPML struct {
+	XMLName xml.Name      `xml:"opml"`
+	Version string        `xml:"version,attr"`
+	Title   string        `xml:"head>title"`
+	Created string        `xml:"head>dateCreated,omitempty"`
+	Body    []OPMLOutline `xml:"body>outline"`
+}
+
+type OPMLOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XmlUrl   string        `xml:"xmlUrl,attr,omitempty"`
+	HtmlUrl  string        `xml:"htmlUrl,attr,omitempty"`
+	Outlines []OPMLOutline `xml:"outline"`
+}
+
+// ParseOPML reads an OPML document and returns one Feed (with Name and Url set) per outline that has an xmlUrl.
+// Nested outlines (folders) are flattened.
+func ParseOPML(r io.Reader) ([]Feed, error) {
+	var doc OPML
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	var result []Feed
+	var walk func([]OPMLOutline)
+	walk = func(outlines []OPMLOutline) {
+		for _, o := range outlines {
+			if o.XmlUrl != "" {
+				name := o.Title
+				if name == "" {
+					name = o.Text
+				}
+				result = append(result, Feed{Name: name, Url: o.XmlUrl})
+			}
+			walk(o.Outlines)
+		}
+	}
+	walk(doc.Body)
+	return result, nil
+}
+
+// WriteOPML writes the feed list as an OPML 2.0 document to w.
+func WriteOPML(w io.Writer, feeds []Feed) error {
+	doc := OPML{
+		Version: "2.0",
+		Title:   "Reader subscriptions",
+		Created: time.Now().Format(time.RFC1123Z),
+	}
+	for _, f := range feeds {
+		if f.Type != TypeRSS {
+			// other source types can't be expressed in OPML
+			continue
+		}
+		doc.Body = append(doc.Body, OPMLOutline{Text: f.Name, Title: f.Name, Type: "rss", XmlUrl: f.Url})
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(doc)
+}
@@ -0,0 +1,57 @@
+package feeds
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ItemQuery holds the parameters for QueryItems. Zero values mean "no restriction".
+type ItemQuery struct {
+	Feed     string     // feed abbreviation
+	Category string     // category name (case-insensitive)
+	Search   string     // free text; phrases in double quotes, prefixes with *
+	Exclude  []string   // items matching any of these terms (or phrases in double quotes) are left out
+	After    *time.Time // published at or after
+	Before   *time.Time // published before
+	MinScore *int       // BreakingNewsScore bounds, inclusive
+	MaxScore *int
+	SavedBy  string // only items saved by this user
+}
+
+// String returns a canonical representation of the query, e.g. for use as a cache key.
+func (q ItemQuery) String() string {
+	var parts []string
+	add := func(format string, a ...interface{}) {
+		parts = append(parts, fmt.Sprintf(format, a...))
+	}
+	if q.Feed != "" {
+		add("feed:%s", q.Feed)
+	}
+	if q.Category != "" {
+		add("category:%q", q.Category)
+	}
+	if q.After != nil {
+		add("after:%d", q.After.Unix())
+	}
+	if q.Before != nil {
+		add("before:%d", q.Before.Unix())
+	}
+	if q.MinScore != nil {
+		add("score>=%d", *q.MinScore)
+	}
+	if q.MaxScore != nil {
+		add("score<=%d", *q.MaxScore)
+	}
+	if q.SavedBy != "" {
+		add("saved:%q", q.SavedBy)
+	}
+	for _, e := range q.Exclude {
+		add("-%q", e)
+	}
+	if q.Search != "" {
+		// quoted, so free text can't pass for one of the operators above
+		add("%q", q.Search)
+	}
+	return strings.Join(parts, " ")
+}
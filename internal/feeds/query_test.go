@@ -0,0 +1,26 @@
+package feeds
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueryItemsExcludesPhrase(t *testing.T) {
+	defer func(c Configuration) { Config = c }(Config)
+	if err := Config.OpenDatabase("file::memory:"); err != nil {
+		t.Fatal(err)
+	}
+	published := time.Now().Add(-time.Hour)
+	for i, title := range []string{"Final of the world cup", "A cup of world-class coffee"} {
+		if err := Config.DB.Create(&Item{Title: title, FeedAbbr: "A", Hash: hashString(title), PublishedParsed: &published}).Error; err != nil {
+			t.Fatalf("item %d: %v", i, err)
+		}
+	}
+	items, err := QueryItems(ItemQuery{Exclude: []string{`"world cup"`}}, 10, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Title != "A cup of world-class coffee" {
+		t.Errorf("got %d items, want only the coffee: %+v", len(items), items)
+	}
+}
@@ -0,0 +1,113 @@
+package feeds
+
+import (
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// savedItemsTable is the join table of users and their saved items (see users.User). Items referenced there are never pruned.
+const savedItemsTable = "user_saved_items"
+
+// SetRetention sets the limits applied by PruneItems: items published more than maxAge ago are deleted and, if maxPerFeed
+// is greater than 0, all but the newest maxPerFeed items of each feed. A maxAge of 0 disables the age limit.
+// New items beyond these limits are not stored in the first place, so pruned items don't come back with the next fetch.
+func (c *Configuration) SetRetention(maxAge time.Duration, maxPerFeed int) {
+	c.RetentionMaxAge, c.RetentionMaxPerFeed = maxAge, maxPerFeed
+}
+
+// retained reports whether a new item of feed abbr, published at published, is within the retention limits.
+func retained(db *gorm.DB, abbr string, published time.Time) bool {
+	if Config.RetentionMaxAge > 0 && published.Before(time.Now().Add(-Config.RetentionMaxAge)) {
+		return false
+	}
+	if Config.RetentionMaxPerFeed > 0 {
+		var newer int64
+		if result := db.Model(&Item{}).Where("feed_abbr = ? AND published_parsed > ?", abbr, published).Count(&newer); result.Error != nil {
+			log.Printf("Error checking retention for feed %v: %v", abbr, result.Error)
+			return true
+		}
+		return newer < int64(Config.RetentionMaxPerFeed)
+	}
+	return true
+}
+
+// PruneItems deletes the items beyond the limits set with SetRetention. Items that a user has saved are kept.
+// Returns the number of deleted items.
+func PruneItems() (int64, error) {
+	var db *gorm.DB
+	if db = Config.DB; db == nil {
+		return 0, ErrNoDBConnection
+	}
+	maxAge, maxPerFeed := Config.RetentionMaxAge, Config.RetentionMaxPerFeed
+	notSaved := func(tx *gorm.DB) *gorm.DB {
+		if !tx.Migrator().HasTable(savedItemsTable) {
+			return tx
+		}
+		return tx.Where("id NOT IN (SELECT item_id FROM " + savedItemsTable + ")")
+	}
+
+	var deleted int64
+	if maxAge > 0 {
+		cutoff := time.Now().Add(-maxAge)
+		result := db.Scopes(notSaved).Where("published_parsed < ?", cutoff).Delete(&Item{})
+		if result.Error != nil {
+			return deleted, result.Error
+		}
+		deleted += result.RowsAffected
+	}
+	if maxPerFeed > 0 {
+		var abbrs []string
+		if result := db.Model(&Item{}).Distinct().Pluck("feed_abbr", &abbrs); result.Error != nil {
+			return deleted, result.Error
+		}
+		for _, abbr := range abbrs {
+			newest := db.Model(&Item{}).Select("id").Where("feed_abbr = ?", abbr).Order("published_parsed desc").Limit(maxPerFeed)
+			result := db.Scopes(notSaved).Where("feed_abbr = ? AND id NOT IN (?)", abbr, newest).Delete(&Item{})
+			if result.Error != nil {
+				return deleted, result.Error
+			}
+			deleted += result.RowsAffected
+		}
+	}
+	if deleted > 0 {
+		return deleted, deleteOrphans(db)
+	}
+	return deleted, nil
+}
+
+// deleteOrphans removes revisions, enclosures and categories of items that no longer exist.
+func deleteOrphans(db *gorm.DB) error {
+	for _, table := range []string{"revisions", "enclosures", "categories"} {
+		if result := db.Exec("DELETE FROM " + table + " WHERE item_id NOT IN (SELECT id FROM items)"); result.Error != nil {
+			return result.Error
+		}
+	}
+	return nil
+}
+
+// Vacuum gives the space of deleted rows back to the file system. The first call switches the database to
+// incremental auto-vacuum (which requires a full VACUUM); later calls only run incremental_vacuum.
+func Vacuum() error {
+	var db *gorm.DB
+	if db = Config.DB; db == nil {
+		return ErrNoDBConnection
+	}
+	// the new auto_vacuum mode only takes effect with a VACUUM on the same connection
+	return db.Connection(func(conn *gorm.DB) error {
+		var mode int
+		if result := conn.Raw("PRAGMA auto_vacuum").Scan(&mode); result.Error != nil {
+			return result.Error
+		}
+		// 2 = INCREMENTAL
+		if mode != 2 {
+			log.Println("Switching database to incremental auto-vacuum (full VACUUM).")
+			if result := conn.Exec("PRAGMA auto_vacuum = INCREMENTAL"); result.Error != nil {
+				return result.Error
+			}
+			return conn.Exec("VACUUM").Error
+		}
+		return conn.Exec("PRAGMA incremental_vacuum").Error
+	})
+}
@@ -0,0 +1,79 @@
+package feeds
+
+import (
+	"html"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Ticker events, see Item.Event.
+const (
+	EventNew     = "new"
+	EventUpdated = "updated"
+)
+
+// Revision is an earlier version of an item's title and description, recorded when the publisher edited the item.
+type Revision struct {
+	ID          uint `gorm:"primaryKey"`
+	CreatedAt   time.Time
+	ItemID      uint `gorm:"index"`
+	Title       string
+	Description string
+}
+
+// reviseItem updates existing if the feed now has a different title or description for it. The previous version is stored as a
+// Revision, the translations are cleared and the item is re-queued for scoring. Reports whether the item was changed.
+func reviseItem(db *gorm.DB, existing *Item, title string, description string, content string) (bool, error) {
+	if title == "" || (title == existing.Title && samePreview(existing.Description, description)) {
+		return false, nil
+	}
+	now := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Create(&Revision{ItemID: existing.ID, Title: existing.Title, Description: existing.Description}); result.Error != nil {
+			return result.Error
+		}
+		return tx.Model(existing).Updates(map[string]interface{}{
+			"title":                  title,
+			"description":            description,
+			"content":                content,
+			"title_translated":       "",
+			"description_translated": "",
+			"breaking_news_score":    0,
+			"breaking_news_reason":   "",
+			"revised_at":             &now,
+			"extracted_at":           nil, // the article has probably changed as well
+			"article_text":           "",
+		}).Error
+	})
+	if err != nil {
+		return false, err
+	}
+	log.Printf("Item %d revised: '%v'", existing.ID, title)
+	return true, nil
+}
+
+// samePreview reports whether two item previews (Item.Description) have the same text. Previews stored before HTMLToText was
+// used still contain entities and differ in whitespace, and a shortened preview ends at a different point, so the previews
+// are compared without whitespace and, if one of them was shortened, only as far as both go.
+func samePreview(stored string, fetched string) bool {
+	a, aShortened := compactPreview(stored)
+	b, bShortened := compactPreview(fetched)
+	if !aShortened && !bShortened {
+		return a == b
+	}
+	n := min(len(a), len(b))
+	return a[:n] == b[:n]
+}
+
+// compactPreview returns the text of a preview without whitespace, and whether it was shortened by writeItemsToDB.
+func compactPreview(s string) (string, bool) {
+	trimmed := strings.TrimSuffix(s, "...")
+	shortened := trimmed != s
+	if i := strings.LastIndexByte(trimmed, '&'); shortened && i >= 0 && !strings.Contains(trimmed[i:], ";") {
+		trimmed = trimmed[:i] // an entity cut in half
+	}
+	return strings.Join(strings.Fields(html.UnescapeString(trimmed)), ""), shortened
+}
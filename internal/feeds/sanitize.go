@@ -0,0 +1,200 @@
+package feeds
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/exp/slices"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// skippedElements are dropped together with their contents, both for text extraction and sanitizing.
+var skippedElements = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true, atom.Iframe: true,
+	atom.Object: true, atom.Embed: true, atom.Svg: true, atom.Math: true, atom.Head: true, atom.Title: true,
+	atom.Select: true, atom.Textarea: true, atom.Button: true,
+}
+
+// blockElements separate words, so "<p>one</p><p>two</p>" becomes "one two" and not "onetwo".
+var blockElements = map[atom.Atom]bool{
+	atom.P: true, atom.Br: true, atom.Div: true, atom.Li: true, atom.Ul: true, atom.Ol: true, atom.Blockquote: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true, atom.Tr: true, atom.Td: true,
+	atom.Th: true, atom.Table: true, atom.Hr: true, atom.Pre: true, atom.Figure: true, atom.Figcaption: true,
+	atom.Section: true, atom.Article: true, atom.Header: true, atom.Footer: true, atom.Img: true, atom.Dd: true, atom.Dt: true,
+}
+
+// allowedElements maps the elements kept by SanitizeHTML to their allowed attributes. Other elements are removed, but
+// their text is kept (unless they are in skippedElements).
+var allowedElements = map[atom.Atom][]string{
+	atom.P: nil, atom.Br: nil, atom.Hr: nil, atom.Div: nil, atom.Span: nil,
+	atom.A:      {"href", "title"},
+	atom.Img:    {"src", "alt", "title", "width", "height"},
+	atom.Strong: nil, atom.B: nil, atom.Em: nil, atom.I: nil, atom.U: nil, atom.S: nil, atom.Sub: nil, atom.Sup: nil,
+	atom.Small: nil, atom.Mark: nil, atom.Q: nil, atom.Cite: nil, atom.Abbr: {"title"}, atom.Time: {"datetime"},
+	atom.Ul: nil, atom.Ol: nil, atom.Li: nil, atom.Dl: nil, atom.Dt: nil, atom.Dd: nil,
+	atom.Blockquote: nil, atom.Pre: nil, atom.Code: nil,
+	atom.H2: nil, atom.H3: nil, atom.H4: nil, atom.H5: nil, atom.H6: nil,
+	atom.Figure: nil, atom.Figcaption: nil,
+	atom.Table: nil, atom.Thead: nil, atom.Tbody: nil, atom.Tfoot: nil, atom.Tr: nil, atom.Th: {"colspan", "rowspan"},
+	atom.Td: {"colspan", "rowspan"}, atom.Caption: nil,
+}
+
+// impliedEnd elements are closed by a sibling of the same kind.
+var impliedEnd = map[atom.Atom]bool{atom.P: true, atom.Li: true, atom.Dt: true, atom.Dd: true, atom.Tr: true, atom.Td: true, atom.Th: true}
+
+// voidElements have no end tag.
+var voidElements = map[atom.Atom]bool{atom.Br: true, atom.Hr: true, atom.Img: true, atom.Embed: true}
+
+// HTMLToText returns the text of an HTML fragment for previews: entities decoded, script and style contents dropped
+// and all whitespace collapsed into single spaces.
+func HTMLToText(s string) string {
+	var b strings.Builder
+	z := html.NewTokenizer(strings.NewReader(s))
+	skipDepth := 0
+	for {
+		switch tt := z.Next(); tt {
+		case html.ErrorToken:
+			return strings.Join(strings.Fields(b.String()), " ")
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			a := atom.Lookup(name)
+			// a self-closing element (<svg/>) has no end tag that would end the skipping
+			if skippedElements[a] && !voidElements[a] && tt == html.StartTagToken {
+				skipDepth++
+			}
+			if blockElements[a] {
+				b.WriteByte(' ')
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			a := atom.Lookup(name)
+			if skippedElements[a] && skipDepth > 0 {
+				skipDepth--
+			}
+			if blockElements[a] {
+				b.WriteByte(' ')
+			}
+		case html.TextToken:
+			if skipDepth == 0 {
+				b.Write(z.Text()) // Text() decodes entities
+			}
+		}
+	}
+}
+
+// SanitizeHTML returns an HTML fragment that only contains allowedElements with their allowed attributes. Links may only
+// point to http(s) and mailto URLs and open in a new tab without a referrer; images must be absolute http(s) URLs.
+// Unclosed elements are closed, stray end tags dropped.
+func SanitizeHTML(s string) string {
+	var b strings.Builder
+	z := html.NewTokenizer(strings.NewReader(s))
+	var open []atom.Atom
+	skipDepth := 0
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break // io.EOF or malformed input - either way, we're done
+		}
+		token := z.Token()
+		a := token.DataAtom
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if skippedElements[a] {
+				if tt == html.StartTagToken && !voidElements[a] {
+					skipDepth++
+				}
+				continue
+			}
+			attrs, ok := allowedElements[a]
+			if skipDepth > 0 || !ok {
+				continue
+			}
+			tag, keep := sanitizeTag(token, attrs)
+			if !keep {
+				continue
+			}
+			// a new list item or paragraph ends the previous one, as in browsers
+			if n := len(open); n > 0 && open[n-1] == a && impliedEnd[a] {
+				b.WriteString("</" + a.String() + ">")
+				open = open[:n-1]
+			}
+			b.WriteString(tag)
+			if !voidElements[a] && tt == html.StartTagToken {
+				open = append(open, a)
+			}
+		case html.EndTagToken:
+			if skippedElements[a] {
+				if skipDepth > 0 {
+					skipDepth--
+				}
+				continue
+			}
+			if skipDepth > 0 {
+				continue
+			}
+			// close up to the matching element, ignore the end tag if there is none
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] == a {
+					for j := len(open) - 1; j >= i; j-- {
+						b.WriteString("</" + open[j].String() + ">")
+					}
+					open = open[:i]
+					break
+				}
+			}
+		case html.TextToken:
+			if skipDepth == 0 {
+				b.WriteString(html.EscapeString(token.Data))
+			}
+		}
+	}
+	for i := len(open) - 1; i >= 0; i-- {
+		b.WriteString("</" + open[i].String() + ">")
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// sanitizeTag renders the start tag of token with only the allowed attributes. Reports false if the element should be
+// dropped (an image without a usable source).
+func sanitizeTag(token html.Token, allowed []string) (string, bool) {
+	var b strings.Builder
+	b.WriteString("<" + token.DataAtom.String())
+	for _, attr := range token.Attr {
+		if attr.Namespace != "" || !slices.Contains(allowed, attr.Key) {
+			continue
+		}
+		value := strings.TrimSpace(attr.Val)
+		switch attr.Key {
+		case "href":
+			if !safeURL(value, "http", "https", "mailto") {
+				continue
+			}
+		case "src":
+			if !safeURL(value, "http", "https") {
+				continue
+			}
+		}
+		b.WriteString(" " + attr.Key + `="` + html.EscapeString(value) + `"`)
+	}
+	switch token.DataAtom {
+	case atom.A:
+		b.WriteString(` target="_blank" rel="noopener noreferrer nofollow"`)
+	case atom.Img:
+		if !strings.Contains(b.String(), ` src="`) {
+			return "", false
+		}
+		b.WriteString(` loading="lazy" referrerpolicy="no-referrer"`)
+	}
+	b.WriteString(">")
+	return b.String(), true
+}
+
+// safeURL reports whether u is an absolute URL with one of the given schemes.
+func safeURL(u string, schemes ...string) bool {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+	return slices.Contains(schemes, strings.ToLower(parsed.Scheme)) && (parsed.Host != "" || parsed.Scheme == "mailto")
+}
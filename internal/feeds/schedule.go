@@ -0,0 +1,73 @@
+package feeds
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	fallbackInterval   = 15              // minutes, used if neither the feed nor Config set an interval
+	maxBackoffFactor   = 8               // quiet feeds are polled at most this many times less often than their base interval
+	maxIntervalMinutes = 24 * 60         // never wait longer than a day
+	quietBackoffStep   = 1.5             // growth of the interval after a poll without new items
+	minIntervalMinutes = 1               // the scheduler ticks once a minute, so anything shorter is meaningless
+	SchedulerTick      = 1 * time.Minute // how often the caller should run UpdateDueFeeds
+)
+
+// BaseInterval returns the configured polling interval of the feed in minutes.
+func (f Feed) BaseInterval() int {
+	interval := f.Interval
+	if interval <= 0 {
+		interval = Config.DefaultInterval
+	}
+	if interval <= 0 {
+		interval = fallbackInterval
+	}
+	if interval < minIntervalMinutes {
+		interval = minIntervalMinutes
+	}
+	return interval
+}
+
+// scheduleNext works out f.CurrentInterval and f.NextFetch after a fetch at time now.
+// Feeds that produced new items go back to their base interval; feeds without new items back off gradually,
+// and failing feeds back off exponentially with the number of consecutive failures. Feeds with an active WebSub subscription
+// are polled at most every pushPollMinutes.
+func (f *Feed) scheduleNext(now time.Time, newItems int) {
+	base := f.BaseInterval()
+	current := f.CurrentInterval
+	if current < base {
+		current = base
+	}
+	ceiling := base * maxBackoffFactor
+	if ceiling > maxIntervalMinutes {
+		ceiling = maxIntervalMinutes
+	}
+
+	switch {
+	case f.ConsecutiveFailures > 0:
+		current = base
+		for i := 0; i < f.ConsecutiveFailures && current < ceiling; i++ {
+			current *= 2
+		}
+	case newItems > 0:
+		current = base
+	default:
+		// rounded up, so short intervals grow as well
+		current = int(math.Ceil(float64(current) * quietBackoffStep))
+	}
+	if current > ceiling {
+		current = ceiling
+	}
+	if current < base {
+		current = base
+	}
+	// new items are pushed by the hub; polling is only a fallback
+	if f.Pushed() && current < pushPollMinutes {
+		current = pushPollMinutes
+	}
+
+	f.CurrentInterval = current
+	next := now.Add(time.Duration(current) * time.Minute)
+	f.NextFetch = &next
+}
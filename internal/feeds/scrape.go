@@ -0,0 +1,140 @@
+package feeds
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"github.com/mmcdole/gofeed"
+)
+
+var ErrNoScrapedItems = errors.New("the item selector matched nothing")
+
+// ScrapeColumns are the columns of Feed.Scrape, for SaveFeed.
+var ScrapeColumns = []string{"scrape_item", "scrape_title", "scrape_link", "scrape_date", "scrape_date_layout", "scrape_description"}
+
+// ScrapeSelectors configure a TypeScrape source: CSS selectors for the element that contains an item, and for the title,
+// link, date and description inside it. Only Item is required; see scrapePage for the defaults.
+type ScrapeSelectors struct {
+	Item        string // e.g. "ul.press-releases li"
+	Title       string // default: the link text
+	Link        string // default: the first link in the item (or the item itself if it is a link)
+	Date        string // default: the first <time> element, if any
+	DateLayout  string // Go time layout for the date (e.g. "02.01.2006"); default: a list of common formats
+	Description string // default: none, as the rest of the item is often boilerplate or changes on every visit ("5 minutes ago")
+}
+
+// scrapeDateLayouts are tried in order if ScrapeSelectors.DateLayout is empty.
+var scrapeDateLayouts = []string{
+	time.RFC3339, time.RFC1123Z, time.RFC1123, time.RFC850, time.ANSIC,
+	"2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02",
+	"02.01.2006 15:04", "02.01.2006", "2.1.2006", "02/01/2006", "01/02/2006",
+	"2 January 2006", "02 January 2006", "2 Jan 2006", "January 2, 2006", "Jan 2, 2006", "Monday, January 2, 2006",
+	"Monday 2 January 2006", "2 January 2006 15:04", "January 2, 2006 15:04",
+}
+
+// Validate checks that the selectors can be compiled and that an item selector is set.
+func (s ScrapeSelectors) Validate() error {
+	if strings.TrimSpace(s.Item) == "" {
+		return errors.New("an item selector is required")
+	}
+	for name, sel := range map[string]string{"item": s.Item, "title": s.Title, "link": s.Link, "date": s.Date, "description": s.Description} {
+		if sel == "" {
+			continue
+		}
+		if _, err := cascadia.Compile(sel); err != nil {
+			return fmt.Errorf("invalid %s selector '%s' (%v)", name, sel, err)
+		}
+	}
+	return nil
+}
+
+// scrapePage reads the items of an HTML page with the selectors in s. Relative links are resolved against base.
+// Items without a link are skipped, because the link is what they are deduplicated by.
+func scrapePage(r io.Reader, base *url.URL, s ScrapeSelectors) (*gofeed.Feed, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return nil, err
+	}
+	feed := &gofeed.Feed{Title: strings.TrimSpace(doc.Find("title").First().Text()), FeedType: TypeScrape}
+	if base != nil {
+		feed.Link = base.String()
+	}
+	matches := doc.Find(s.Item)
+	if matches.Length() == 0 {
+		return nil, ErrNoScrapedItems
+	}
+	matches.Each(func(i int, container *goquery.Selection) {
+		link := container
+		if s.Link != "" {
+			link = container.Find(s.Link).First()
+		} else if goquery.NodeName(container) != "a" {
+			link = container.Find("a[href]").First()
+		}
+		href, ok := link.Attr("href")
+		if !ok {
+			return
+		}
+		ref, err := url.Parse(strings.TrimSpace(href))
+		if err != nil {
+			return
+		}
+		if base != nil {
+			ref = base.ResolveReference(ref)
+		}
+		if ref.Scheme != "http" && ref.Scheme != "https" {
+			return
+		}
+
+		titleSel := link
+		if s.Title != "" {
+			titleSel = container.Find(s.Title).First()
+		}
+		title := strings.Join(strings.Fields(titleSel.Text()), " ")
+		if title == "" {
+			return
+		}
+
+		item := &gofeed.Item{Title: title, Link: ref.String()}
+		dateSel := container.Find("time").First()
+		if s.Date != "" {
+			dateSel = container.Find(s.Date).First()
+		}
+		if dateSel.Length() > 0 {
+			raw := dateSel.AttrOr("datetime", "")
+			if raw == "" {
+				raw = strings.Join(strings.Fields(dateSel.Text()), " ")
+			}
+			item.Published = raw
+			item.PublishedParsed = parseScrapedDate(raw, s.DateLayout)
+		}
+		if s.Description != "" {
+			item.Description = strings.Join(strings.Fields(container.Find(s.Description).First().Text()), " ")
+		}
+		feed.Items = append(feed.Items, item)
+	})
+	return feed, nil
+}
+
+// parseScrapedDate parses raw with layout, or with scrapeDateLayouts if layout is empty. Returns nil if that fails,
+// so the item falls back to the time it is first seen.
+func parseScrapedDate(raw string, layout string) *time.Time {
+	layouts := scrapeDateLayouts
+	if layout != "" {
+		layouts = []string{layout}
+	}
+	for _, l := range layouts {
+		if t, err := time.Parse(l, raw); err == nil {
+			return &t
+		}
+	}
+	return nil
+}
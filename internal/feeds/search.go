@@ -0,0 +1,140 @@
+package feeds
+
+import (
+	"log"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ftsTable is an external-content FTS5 index over items.title and items.description. Triggers keep it in sync with the items table.
+const ftsTable = "items_fts"
+
+var ftsSetup = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS items_fts USING fts5(title, description, content='items', content_rowid='id', tokenize='unicode61 remove_diacritics 2')`,
+	`CREATE TRIGGER IF NOT EXISTS items_fts_insert AFTER INSERT ON items BEGIN
+		INSERT INTO items_fts(rowid, title, description) VALUES (new.id, new.title, new.description);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS items_fts_delete AFTER DELETE ON items BEGIN
+		INSERT INTO items_fts(items_fts, rowid, title, description) VALUES ('delete', old.id, old.title, old.description);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS items_fts_update AFTER UPDATE OF title, description ON items BEGIN
+		INSERT INTO items_fts(items_fts, rowid, title, description) VALUES ('delete', old.id, old.title, old.description);
+		INSERT INTO items_fts(rowid, title, description) VALUES (new.id, new.title, new.description);
+	END`,
+}
+
+// ftsTriggers are the triggers created by ftsSetup.
+var ftsTriggers = []string{"items_fts_insert", "items_fts_delete", "items_fts_update"}
+
+// setupFullTextSearch creates the FTS5 index and its triggers (indexing existing items on first run, or if the triggers were
+// removed). FTS5 is only available if the sqlite driver was built with the sqlite_fts5 tag; otherwise search falls back to LIKE.
+func setupFullTextSearch(db *gorm.DB) bool {
+	var fts5 bool
+	if err := db.Raw(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&fts5).Error; err != nil || !fts5 {
+		log.Println("Full-text search not available, falling back to LIKE search. Build with -tags sqlite_fts5 to enable it.")
+		removeFullTextSearch(db)
+		return false
+	}
+	var triggers int64
+	if err := db.Raw(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name IN ?`, ftsTriggers).Scan(&triggers).Error; err != nil {
+		log.Printf("Error checking full-text index: %v", err)
+	}
+	current := db.Migrator().HasTable(ftsTable) && triggers == int64(len(ftsTriggers))
+	for _, stmt := range ftsSetup {
+		if err := db.Exec(stmt).Error; err != nil {
+			log.Printf("Full-text search not available, falling back to LIKE search (%v).", err)
+			removeFullTextSearch(db)
+			return false
+		}
+	}
+	if !current {
+		log.Println("Building full-text index.")
+		if err := db.Exec(`INSERT INTO items_fts(items_fts) VALUES ('rebuild')`).Error; err != nil {
+			log.Printf("Error building full-text index: %v", err)
+			removeFullTextSearch(db)
+			return false
+		}
+	}
+	return true
+}
+
+// removeFullTextSearch drops the triggers that keep the FTS5 index up to date, as they make every change to items fail
+// without FTS5, and the index itself if possible (dropping it needs FTS5 as well). setupFullTextSearch rebuilds the index
+// once FTS5 is available again.
+func removeFullTextSearch(db *gorm.DB) {
+	for _, trigger := range ftsTriggers {
+		if err := db.Exec(`DROP TRIGGER IF EXISTS ` + trigger).Error; err != nil {
+			log.Printf("Error removing full-text index trigger %v: %v", trigger, err)
+		}
+	}
+	if db.Migrator().HasTable(ftsTable) {
+		// fails without FTS5; the stale index is rebuilt when FTS5 is available again
+		db.Session(&gorm.Session{Logger: logger.Discard}).Exec(`DROP TABLE ` + ftsTable)
+	}
+}
+
+// ftsQuery turns user input into a safe FTS5 query. Text in double quotes is searched as a phrase, a word ending
+// in * as a prefix; everything else is quoted so that FTS5 operators and punctuation in the input have no effect.
+// All terms must match.
+func ftsQuery(search string) string {
+	var terms []string
+	for _, t := range splitSearchTerms(search) {
+		prefix := !t.phrase && strings.HasSuffix(t.text, "*")
+		text := strings.TrimRight(t.text, "*")
+		if strings.TrimFunc(text, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsNumber(r) }) == "" {
+			continue
+		}
+		term := `"` + strings.ReplaceAll(text, `"`, `""`) + `"`
+		if prefix {
+			term += "*"
+		}
+		terms = append(terms, term)
+	}
+	return strings.Join(terms, " ")
+}
+
+// likeEscaper escapes the LIKE wildcards in user input, for use with ESCAPE '\'.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// likePattern turns user input into a pattern for the LIKE fallback search (with ESCAPE '\').
+func likePattern(search string) string {
+	var words []string
+	for _, t := range splitSearchTerms(search) {
+		words = append(words, likeEscaper.Replace(strings.TrimRight(t.text, "*")))
+	}
+	return "%" + strings.Join(words, " ") + "%"
+}
+
+type searchTerm struct {
+	text   string
+	phrase bool
+}
+
+// splitSearchTerms splits the input at whitespace, keeping text in double quotes together as a phrase.
+func splitSearchTerms(search string) []searchTerm {
+	var terms []searchTerm
+	var current strings.Builder
+	inQuotes := false
+	flush := func(phrase bool) {
+		if s := strings.TrimSpace(current.String()); s != "" {
+			terms = append(terms, searchTerm{text: s, phrase: phrase})
+		}
+		current.Reset()
+	}
+	for _, r := range search {
+		switch {
+		case r == '"':
+			flush(inQuotes)
+			inQuotes = !inQuotes
+		case unicode.IsSpace(r) && !inQuotes:
+			flush(false)
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush(inQuotes)
+	return terms
+}
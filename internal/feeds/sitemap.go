@@ -0,0 +1,246 @@
+package feeds
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	maxChildSitemaps = 3        // sitemaps read from a sitemap index, the most recently modified first
+	maxSitemapBytes  = 20 << 20 // after decompression
+)
+
+var ErrNoNewsEntries = errors.New("the sitemap has no news entries (is it a Google News sitemap?)")
+
+// sitemapDocument is a sitemap (<urlset>) or a sitemap index (<sitemapindex>). Elements are matched by their local name,
+// so the news: and image: prefixes don't matter.
+type sitemapDocument struct {
+	XMLName  xml.Name
+	URLs     []sitemapURL `xml:"url"`
+	Sitemaps []struct {
+		Loc     string `xml:"loc"`
+		LastMod string `xml:"lastmod"`
+	} `xml:"sitemap"`
+}
+
+type sitemapURL struct {
+	Loc  string `xml:"loc"`
+	News struct {
+		Title           string `xml:"title"`
+		PublicationDate string `xml:"publication_date"`
+		Keywords        string `xml:"keywords"`
+		Publication     struct {
+			Name string `xml:"name"`
+		} `xml:"publication"`
+	} `xml:"news"`
+	Images []struct {
+		Loc string `xml:"loc"`
+	} `xml:"image"`
+}
+
+// sitemapValidator is what is known about a sitemap read from a sitemap index: its <lastmod> in the index and the conditional
+// GET validators of the last response. Feed.SitemapValidators holds them as JSON, by URL.
+type sitemapValidator struct {
+	LastMod      string `json:"lastmod,omitempty"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+// sitemapDateLayouts are the W3C datetime variants used in sitemaps.
+var sitemapDateLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04Z07:00", "2006-01-02T15:04:05", "2006-01-02"}
+
+// parseSitemapDate parses a W3C datetime; ok is false if s isn't one.
+func parseSitemapDate(s string) (t time.Time, ok bool) {
+	for _, layout := range sitemapDateLayouts {
+		if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// readSitemap turns a Google News sitemap into a feed: <news:title> is the title, <loc> the link and
+// <news:publication_date> the publish date; <news:keywords> become categories and the first <image:loc> the lead image.
+// For a sitemap index, the maxChildSitemaps most recent sitemaps are read. They are only fetched (see fetchSitemap) if their
+// <lastmod> changed since the last poll, with the validators stored in f.SitemapValidators for conditional GET.
+func readSitemap(ctx context.Context, f *Feed, body io.Reader, base *url.URL) (*gofeed.Feed, error) {
+	doc, err := decodeSitemap(body)
+	if err != nil {
+		return nil, err
+	}
+	feed := &gofeed.Feed{Title: base.Hostname(), Link: base.String(), FeedType: TypeSitemap}
+	if doc.XMLName.Local == "sitemapindex" {
+		children := doc.Sitemaps
+		// newest first; undated sitemaps keep their order after the dated ones
+		sort.SliceStable(children, func(i, j int) bool {
+			ti, iDated := parseSitemapDate(children[i].LastMod)
+			tj, jDated := parseSitemapDate(children[j].LastMod)
+			return iDated && (!jDated || ti.After(tj))
+		})
+		var known map[string]sitemapValidator
+		if f.SitemapValidators != "" {
+			if err := json.Unmarshal([]byte(f.SitemapValidators), &known); err != nil {
+				known = nil // read the sitemaps again
+			}
+		}
+		validators := make(map[string]sitemapValidator)
+		var childErr error
+		for _, child := range children {
+			if len(validators) == maxChildSitemaps {
+				break
+			}
+			ref, err := url.Parse(strings.TrimSpace(child.Loc))
+			if err != nil {
+				continue
+			}
+			link := base.ResolveReference(ref).String()
+			v, lastMod := known[link], strings.TrimSpace(child.LastMod)
+			if lastMod != "" && lastMod == v.LastMod {
+				// unchanged since the last poll
+				validators[link] = v
+				continue
+			}
+			data, next, err := fetchSitemap(ctx, *f, link, v)
+			if errors.Is(err, ErrNotModified) {
+				v.LastMod = lastMod
+				validators[link] = v
+				continue
+			}
+			if err == nil {
+				var childDoc sitemapDocument
+				if childDoc, err = decodeSitemap(bytes.NewReader(data)); err == nil {
+					doc.URLs = append(doc.URLs, childDoc.URLs...)
+					next.LastMod = lastMod
+					validators[link] = next
+					continue
+				}
+			}
+			// tried again with the next poll
+			validators[link] = sitemapValidator{}
+			childErr = err
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+		}
+		if len(doc.URLs) == 0 && childErr != nil {
+			return nil, childErr
+		}
+		encoded, err := json.Marshal(validators)
+		if err != nil {
+			return nil, err
+		}
+		f.SitemapValidators = string(encoded)
+	} else if doc.XMLName.Local != "urlset" {
+		return nil, errors.New("not a sitemap")
+	}
+
+	for _, u := range doc.URLs {
+		title := strings.Join(strings.Fields(u.News.Title), " ")
+		ref, err := url.Parse(strings.TrimSpace(u.Loc))
+		if title == "" || err != nil {
+			continue
+		}
+		item := &gofeed.Item{Title: title, Link: base.ResolveReference(ref).String(), Published: strings.TrimSpace(u.News.PublicationDate)}
+		if t, ok := parseSitemapDate(item.Published); ok {
+			item.PublishedParsed = &t
+		}
+		for _, keyword := range strings.Split(u.News.Keywords, ",") {
+			if keyword = strings.TrimSpace(keyword); keyword != "" {
+				item.Categories = append(item.Categories, keyword)
+			}
+		}
+		if len(u.Images) > 0 && safeURL(strings.TrimSpace(u.Images[0].Loc), "http", "https") {
+			item.Image = &gofeed.Image{URL: strings.TrimSpace(u.Images[0].Loc)}
+		}
+		if name := strings.TrimSpace(u.News.Publication.Name); name != "" {
+			feed.Title = name
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	if len(feed.Items) == 0 && len(doc.URLs) > 0 {
+		return nil, ErrNoNewsEntries
+	}
+	return feed, nil
+}
+
+// decodeSitemap parses a sitemap or sitemap index, which may be gzip-compressed (sitemap.xml.gz).
+func decodeSitemap(r io.Reader) (sitemapDocument, error) {
+	var doc sitemapDocument
+	data, err := io.ReadAll(io.LimitReader(r, maxSitemapBytes))
+	if err != nil {
+		return doc, err
+	}
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return doc, err
+		}
+		if data, err = io.ReadAll(io.LimitReader(zr, maxSitemapBytes)); err != nil {
+			return doc, err
+		}
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	decoder.CharsetReader = charset.NewReaderLabel
+	err = decoder.Decode(&doc)
+	return doc, err
+}
+
+// fetchSitemap downloads a sitemap listed in the sitemap index of f, conditionally if v has validators; returns ErrNotModified
+// if it hasn't changed, and the validators of the response. The feed's request options are only sent to its own host.
+func fetchSitemap(ctx context.Context, f Feed, link string, v sitemapValidator) ([]byte, sitemapValidator, error) {
+	_, timeout, hostDelay, userAgent := Config.fetcherSettings()
+	host := feedHost(link)
+	if err := hosts.wait(ctx, host, hostDelay); err != nil {
+		return nil, v, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, v, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	if v.ETag != "" {
+		req.Header.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		req.Header.Set("If-Modified-Since", v.LastModified)
+	}
+	client, release := http.DefaultClient, func() {}
+	if host == feedHost(f.Url) {
+		if err := f.applyRequestOptions(req); err != nil {
+			return nil, v, err
+		}
+		if client, release, err = f.httpClient(); err != nil {
+			return nil, v, err
+		}
+	}
+	defer release()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, v, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, v, ErrNotModified
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, v, gofeed.HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSitemapBytes))
+	return data, sitemapValidator{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}, err
+}
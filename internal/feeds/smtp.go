@@ -0,0 +1,215 @@
+package feeds
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"gorm.io/gorm"
+)
+
+const (
+	smtpMaxConnections = 10
+	smtpMaxRecipients  = 20
+	smtpTimeout        = 5 * time.Minute // per command, and for the message data
+)
+
+// ListenSMTP runs a minimal SMTP server on addr that accepts newsletters for smtp mailboxes (see ValidateMailboxUrl) until ctx
+// is done. A message to <name>@<any domain> (or <name>+<tag>@...) becomes an item of the mail source with the Url "smtp:<name>";
+// other recipients are refused, so the server can't be used as a relay. There is no authentication or TLS - listen on
+// localhost or a private network and let the mail server in front of Reader forward newsletters to it.
+func ListenSMTP(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "reader"
+	}
+	slots := make(chan struct{}, smtpMaxConnections)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return err
+		}
+		select {
+		case slots <- struct{}{}:
+			go func() {
+				defer func() { <-slots }()
+				serveSMTP(conn, hostname)
+			}()
+		default:
+			fmt.Fprintf(conn, "421 %s too many connections, try again later\r\n", hostname)
+			conn.Close()
+		}
+	}
+}
+
+// serveSMTP handles one SMTP session.
+func serveSMTP(conn net.Conn, hostname string) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	reply := func(format string, args ...interface{}) {
+		conn.SetWriteDeadline(time.Now().Add(smtpTimeout))
+		tp.PrintfLine(format, args...)
+	}
+	reply("220 %s Reader ESMTP", hostname)
+
+	var sender string
+	var recipients []Feed
+	for {
+		conn.SetReadDeadline(time.Now().Add(smtpTimeout))
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		arg = strings.TrimSpace(arg)
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			reply("250 %s", hostname)
+		case "EHLO":
+			reply("250-%s", hostname)
+			reply("250-SIZE %d", maxMessageBytes)
+			reply("250 8BITMIME")
+		case "MAIL":
+			if !strings.HasPrefix(strings.ToUpper(arg), "FROM:") {
+				reply("501 Syntax: MAIL FROM:<address>")
+				continue
+			}
+			sender, recipients = smtpAddress(arg[len("FROM:"):]), nil
+			reply("250 OK")
+		case "RCPT":
+			if !strings.HasPrefix(strings.ToUpper(arg), "TO:") {
+				reply("501 Syntax: RCPT TO:<address>")
+				continue
+			}
+			if sender == "" {
+				reply("503 MAIL first")
+				continue
+			}
+			if len(recipients) >= smtpMaxRecipients {
+				reply("452 Too many recipients")
+				continue
+			}
+			feed, err := smtpMailbox(smtpAddress(arg[len("TO:"):]))
+			if err != nil {
+				reply("550 No such mailbox")
+				continue
+			}
+			recipients = append(recipients, feed)
+			reply("250 OK")
+		case "DATA":
+			if len(recipients) == 0 {
+				reply("503 RCPT first")
+				continue
+			}
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			conn.SetReadDeadline(time.Now().Add(smtpTimeout))
+			dot := tp.DotReader()
+			data, err := io.ReadAll(io.LimitReader(dot, maxMessageBytes+1))
+			if err != nil {
+				return
+			}
+			if len(data) > maxMessageBytes {
+				io.Copy(io.Discard, dot)
+				reply("552 Message too large")
+			} else if err := deliverMessage(data, recipients); err != nil {
+				log.Printf("Refusing message from %v: %v", sender, err)
+				reply("554 Message refused (%v)", err)
+			} else {
+				reply("250 OK")
+			}
+			sender, recipients = "", nil
+		case "RSET":
+			sender, recipients = "", nil
+			reply("250 OK")
+		case "NOOP":
+			reply("250 OK")
+		case "VRFY":
+			reply("252 Cannot verify")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+// smtpAddress extracts the address from the argument of MAIL FROM or RCPT TO, e.g. "<news@example.com> SIZE=1234".
+// The null sender "<>" is returned as "<>".
+func smtpAddress(arg string) string {
+	arg = strings.TrimSpace(arg)
+	if start := strings.Index(arg, "<"); start >= 0 {
+		if end := strings.Index(arg[start:], ">"); end >= 0 {
+			if addr := arg[start+1 : start+end]; addr != "" {
+				return addr
+			}
+			return "<>"
+		}
+	}
+	addr, _, _ := strings.Cut(arg, " ")
+	return addr
+}
+
+// smtpMailbox returns the active mail source that receives messages for addr.
+func smtpMailbox(addr string) (Feed, error) {
+	var db *gorm.DB
+	if db = Config.DB; db == nil {
+		return Feed{}, ErrNoDBConnection
+	}
+	local, _, found := strings.Cut(addr, "@")
+	if !found {
+		return Feed{}, ErrInvalidMailbox
+	}
+	local, _, _ = strings.Cut(local, "+")
+	var feed Feed
+	result := db.Where("type = ? AND url = ? AND paused = ?", TypeMail, mailboxSMTP+":"+strings.ToLower(local), false).Limit(1).Find(&feed)
+	if result.Error == nil && feed.ID == 0 {
+		return feed, ErrInvalidMailbox
+	}
+	return feed, result.Error
+}
+
+// deliverMessage stores a received message as an item of each of the mail sources it was sent to.
+func deliverMessage(data []byte, recipients []Feed) error {
+	var db *gorm.DB
+	if db = Config.DB; db == nil {
+		return ErrNoDBConnection
+	}
+	item, err := parseMessage(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, f := range recipients {
+		n := writeItemsToDB(db, &gofeed.Feed{Title: f.Name, FeedType: TypeMail, Items: []*gofeed.Item{item}}, f.Abbr, f.Location())
+		pushedItems.Add(int64(n))
+		if result := db.Model(&f).Update("last_success", &now); result.Error != nil {
+			log.Printf("Error saving delivery time for %v: %v", f.Name, result.Error)
+		}
+	}
+	return nil
+}
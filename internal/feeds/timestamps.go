@@ -0,0 +1,63 @@
+package feeds
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// Where an item's PublishedParsed came from, see Item.TimestampSource.
+const (
+	TimestampPublished = "published"  // the feed's publish date
+	TimestampUpdated   = "updated"    // the feed's update date, the item had no (parsable) publish date
+	TimestampFirstSeen = "first-seen" // the time Reader first saw the item, the feed had no usable date at all
+)
+
+// zoneSuffix matches date strings that end in a UTC offset or time zone name (but not in AM/PM).
+var zoneSuffix = regexp.MustCompile(`(?i)(z|[+-]\d{2}:?\d{2}|\b(?:[a-z]{1,5}))$`)
+
+// hasZone reports whether a raw date string from a feed specifies its time zone.
+func hasZone(raw string) bool {
+	raw = strings.TrimSpace(raw)
+	if m := zoneSuffix.FindString(raw); m != "" {
+		upper := strings.ToUpper(m)
+		return upper != "AM" && upper != "PM"
+	}
+	return false
+}
+
+// inLocation reinterprets the wall clock time of t, parsed from raw, in loc if raw had no time zone
+// (gofeed treats such times as UTC). Returns t unchanged if loc is nil or raw has a time zone.
+func inLocation(t *time.Time, raw string, loc *time.Location) *time.Time {
+	if t == nil || loc == nil || hasZone(raw) {
+		return t
+	}
+	local := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+	return &local
+}
+
+// itemTimestamp returns the time an item was published and where that time came from: the publish date, else the update date,
+// else firstSeen. Dates without a time zone are read in loc (if not nil).
+func itemTimestamp(item *gofeed.Item, loc *time.Location, firstSeen time.Time) (*time.Time, string) {
+	if item.PublishedParsed != nil && !item.PublishedParsed.IsZero() {
+		return inLocation(item.PublishedParsed, item.Published, loc), TimestampPublished
+	}
+	if item.UpdatedParsed != nil && !item.UpdatedParsed.IsZero() {
+		return inLocation(item.UpdatedParsed, item.Updated, loc), TimestampUpdated
+	}
+	return &firstSeen, TimestampFirstSeen
+}
+
+// Location returns the time zone set for the feed, or nil if there is none (or it isn't valid).
+func (f Feed) Location() *time.Location {
+	if f.Timezone == "" {
+		return nil
+	}
+	loc, err := time.LoadLocation(f.Timezone)
+	if err != nil {
+		return nil
+	}
+	return loc
+}
@@ -0,0 +1,367 @@
+package feeds
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+	"gorm.io/gorm"
+)
+
+// WebSub subscription states, see Feed.PushState.
+const (
+	PushNone    = ""
+	PushPending = "pending" // (re)subscription requested, waiting for the hub to verify it
+	PushActive  = "active"
+	PushEnding  = "ending" // unsubscription requested
+	PushDenied  = "denied" // the hub refused the subscription, see webSubDeniedRetry
+)
+
+const (
+	WebSubPath        = "/websub/" // callback URLs are Config.PublicUrl + WebSubPath + feed ID
+	webSubLease       = 7 * 24 * time.Hour
+	webSubRenewBefore = 24 * time.Hour // leases are renewed this long before they end
+	webSubRetry       = time.Hour      // unverified requests are given up (and retried) after this; also the minimum time between renewals
+	webSubDeniedRetry = 24 * time.Hour // a hub that denied a subscription is asked again after this
+	pushPollMinutes   = 6 * 60         // polling interval of feeds with an active subscription
+	maxPushBytes      = 5 << 20
+)
+
+var (
+	ErrUnknownSubscription = errors.New("no such subscription")
+	ErrInvalidSignature    = errors.New("invalid or missing signature")
+	ErrInvalidContent      = errors.New("pushed content is not a feed")
+)
+
+// SetWebSub sets the public URL of Reader (e.g. https://reader.example.com), which hubs send their callbacks to.
+// "" disables WebSub, so all feeds are polled.
+func (c *Configuration) SetWebSub(publicUrl string) {
+	c.PublicUrl = strings.TrimRight(publicUrl, "/")
+}
+
+// Pushed reports whether the feed has an active WebSub subscription, so new items arrive without polling.
+func (f Feed) Pushed() bool {
+	return f.PushState != PushNone && f.PushExpires != nil && f.PushExpires.After(time.Now())
+}
+
+// callbackUrl returns the URL the hub sends the feed's verifications and content to.
+func (f Feed) callbackUrl() string {
+	return Config.PublicUrl + WebSubPath + strconv.FormatUint(uint64(f.ID), 10)
+}
+
+// setHub records the hub and self URL found by discoverHub. The topic defaults to the feed URL. If they changed,
+// the push state is reset, so SyncWebSub subscribes at the new hub.
+func (f *Feed) setHub(hub string, self string) {
+	if self == "" && hub != "" {
+		self = f.Url
+	}
+	if hub == f.HubUrl && self == f.TopicUrl {
+		return
+	}
+	f.HubUrl, f.TopicUrl = hub, self
+	f.PushState, f.PushExpires = PushNone, nil
+	f.hubChanged = true
+}
+
+// discoverHub returns the WebSub hub and self URL of a feed, from the Link header of the response or else from the
+// <link rel="hub"> and <link rel="self"> elements of the feed (atom:link in RSS). Only https hubs are returned, as the
+// subscription secret must not be sent in the clear.
+func discoverHub(header http.Header, body []byte) (hub string, self string) {
+	for _, value := range header.Values("Link") {
+		for _, link := range strings.Split(value, ",") {
+			target, params, _ := strings.Cut(link, ";")
+			target = strings.Trim(strings.TrimSpace(target), "<>")
+			for _, param := range strings.Split(params, ";") {
+				name, rel, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if strings.EqualFold(name, "rel") {
+					hub, self = relLink(strings.Trim(rel, `"`), target, hub, self)
+				}
+			}
+		}
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.Strict = false
+	decoder.CharsetReader = charset.NewReaderLabel
+	for hub == "" || self == "" {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if start.Name.Local == "item" || start.Name.Local == "entry" {
+			// links of items are not about the feed
+			break
+		}
+		if start.Name.Local != "link" {
+			continue
+		}
+		var rel, href string
+		for _, attr := range start.Attr {
+			switch attr.Name.Local {
+			case "rel":
+				rel = attr.Value
+			case "href":
+				href = attr.Value
+			}
+		}
+		hub, self = relLink(rel, strings.TrimSpace(href), hub, self)
+	}
+	if !safeURL(hub, "https") {
+		return "", ""
+	}
+	return hub, self
+}
+
+// relLink sets hub or self to target if they are still empty and rel (a space-separated list) says it is one of them.
+func relLink(rel string, target string, hub string, self string) (string, string) {
+	if !safeURL(target, "http", "https") {
+		return hub, self
+	}
+	for _, r := range strings.Fields(strings.ToLower(rel)) {
+		if r == "hub" && hub == "" {
+			hub = target
+		}
+		if r == "self" && self == "" {
+			self = target
+		}
+	}
+	return hub, self
+}
+
+// SyncWebSub sends subscription requests to the hubs of feeds that aren't subscribed yet or whose lease is about to end,
+// and unsubscribes feeds that were paused or deleted or no longer have a hub. The hub then verifies the request with a
+// callback, see VerifyWebSub. Requests that aren't verified within webSubRetry are tried again. Returns the number of
+// requests sent; does nothing unless a public URL has been set with SetWebSub.
+func SyncWebSub(ctx context.Context) (int, error) {
+	var db *gorm.DB
+	if db = Config.DB; db == nil {
+		return 0, ErrNoDBConnection
+	}
+	if Config.PublicUrl == "" {
+		return 0, nil
+	}
+	now := time.Now()
+	// unsubscriptions the hub never verified have ended anyway, or will when the lease runs out
+	if result := db.Unscoped().Model(&Feed{}).Where("push_state = ? AND push_since < ?", PushEnding, now.Add(-webSubRetry)).
+		Updates(map[string]interface{}{"push_state": PushNone, "push_expires": nil}); result.Error != nil {
+		return 0, result.Error
+	}
+
+	var stale []Feed
+	result := db.Unscoped().Where("push_state IN ?", []string{PushPending, PushActive}).
+		Where("deleted_at IS NOT NULL OR paused = ? OR hub_url = '' OR type <> ?", true, TypeRSS).Find(&stale)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	var due []Feed
+	result = db.Where("type = ? AND paused = ? AND hub_url LIKE 'https://%'", TypeRSS, false).
+		Where("push_state = ? OR (push_state = ? AND push_since < ?) OR (push_state IN ? AND push_since < ? AND (push_state = ? OR push_expires IS NULL OR push_expires < ?))",
+			PushNone, PushDenied, now.Add(-webSubDeniedRetry), []string{PushPending, PushActive}, now.Add(-webSubRetry), PushPending, now.Add(webSubRenewBefore)).Find(&due)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	sent := 0
+	for _, f := range stale {
+		f.PushState, f.PushSince = PushEnding, &now
+		if f.HubUrl == "" {
+			f.PushState, f.PushExpires = PushNone, nil
+		} else if err := webSubRequest(ctx, f, "unsubscribe"); err != nil {
+			log.Printf("Error unsubscribing %v at %v: %v", f.Name, f.HubUrl, err)
+		} else {
+			sent++
+		}
+		if result := db.Unscoped().Model(&f).Select("PushState", "PushSince", "PushExpires").Updates(&f); result.Error != nil {
+			return sent, result.Error
+		}
+	}
+	for _, f := range due {
+		if ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+		if f.PushSecret == "" {
+			secret := make([]byte, 32)
+			if _, err := rand.Read(secret); err != nil {
+				return sent, err
+			}
+			f.PushSecret = hex.EncodeToString(secret)
+		}
+		// if the request fails, it is retried like an unverified one
+		f.PushState, f.PushSince = PushPending, &now
+		if err := webSubRequest(ctx, f, "subscribe"); err != nil {
+			log.Printf("Error subscribing to %v at %v: %v", f.Name, f.HubUrl, err)
+		} else {
+			sent++
+		}
+		if result := db.Model(&f).Select("PushState", "PushSince", "PushSecret").Updates(&f); result.Error != nil {
+			return sent, result.Error
+		}
+	}
+	return sent, nil
+}
+
+// webSubRequest sends a subscribe or unsubscribe request for f to its hub.
+func webSubRequest(ctx context.Context, f Feed, mode string) error {
+	form := url.Values{"hub.mode": {mode}, "hub.topic": {f.TopicUrl}, "hub.callback": {f.callbackUrl()}}
+	if mode == "subscribe" {
+		form.Set("hub.secret", f.PushSecret)
+		form.Set("hub.lease_seconds", strconv.Itoa(int(webSubLease.Seconds())))
+	}
+	_, timeout, _, userAgent := Config.fetcherSettings()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.HubUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		return fmt.Errorf("hub returned %v (%s)", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// VerifyWebSub answers the hub's verification of a (un)subscription request for the feed with the given id, with the
+// query parameters of the callback. Returns the challenge to echo back, or ErrUnknownSubscription if the request
+// didn't come from Reader. A denied subscription is recorded and only requested again after webSubDeniedRetry.
+func VerifyWebSub(id uint, query url.Values) (string, error) {
+	var db *gorm.DB
+	if db = Config.DB; db == nil {
+		return "", ErrNoDBConnection
+	}
+	var f Feed
+	if result := db.Unscoped().Limit(1).Find(&f, id); result.Error != nil {
+		return "", result.Error
+	}
+	if f.ID == 0 || query.Get("hub.topic") != f.TopicUrl {
+		return "", ErrUnknownSubscription
+	}
+	now := time.Now()
+	update := map[string]interface{}{"push_since": &now}
+	switch query.Get("hub.mode") {
+	case "subscribe":
+		// only requests sent by SyncWebSub are verified, and for no longer than requested: the callback URL is public
+		if f.DeletedAt.Valid || f.Paused || f.PushState != PushPending {
+			return "", ErrUnknownSubscription
+		}
+		lease := webSubLease
+		if seconds, err := strconv.Atoi(query.Get("hub.lease_seconds")); err == nil && seconds > 0 && seconds < int(webSubLease.Seconds()) {
+			lease = time.Duration(seconds) * time.Second
+		}
+		update["push_state"], update["push_expires"] = PushActive, now.Add(lease)
+		log.Printf("Subscribed to %v at %v until %v.", f.Name, f.HubUrl, now.Add(lease).Format(time.RFC3339))
+	case "unsubscribe":
+		if f.PushState != PushEnding {
+			return "", ErrUnknownSubscription
+		}
+		update["push_state"], update["push_expires"] = PushNone, nil
+	case "denied":
+		if f.PushState != PushPending && f.PushState != PushActive {
+			return "", ErrUnknownSubscription
+		}
+		log.Printf("Hub %v denied the subscription to %v (%v).", f.HubUrl, f.Name, query.Get("hub.reason"))
+		update["push_state"], update["push_expires"] = PushDenied, nil
+	default:
+		return "", ErrUnknownSubscription
+	}
+	if result := db.Unscoped().Model(&Feed{}).Where("id = ?", f.ID).Updates(update); result.Error != nil {
+		return "", result.Error
+	}
+	return query.Get("hub.challenge"), nil
+}
+
+// ReceiveWebSub ingests content that the hub pushed for the feed with the given id like a polled feed, after checking
+// the HMAC signature (the X-Hub-Signature header). Returns the number of new and revised items,
+// ErrUnknownSubscription if the feed isn't subscribed (any more), ErrInvalidSignature or ErrInvalidContent; other errors
+// (database, reading the body) may go away if the hub tries again.
+func ReceiveWebSub(id uint, signature string, body io.Reader) (int, error) {
+	var db *gorm.DB
+	if db = Config.DB; db == nil {
+		return 0, ErrNoDBConnection
+	}
+	var f Feed
+	if result := db.Limit(1).Find(&f, id); result.Error != nil {
+		return 0, result.Error
+	}
+	if f.ID == 0 || f.Paused || f.Type != TypeRSS || (f.PushState != PushActive && f.PushState != PushPending) {
+		return 0, ErrUnknownSubscription
+	}
+	content, err := io.ReadAll(io.LimitReader(body, maxPushBytes))
+	if err != nil {
+		return 0, err
+	}
+	if !validSignature(f.PushSecret, signature, content) {
+		return 0, ErrInvalidSignature
+	}
+	base, err := url.Parse(f.TopicUrl)
+	if err != nil {
+		return 0, err
+	}
+	feed, err := parseSource(context.Background(), &f, bytes.NewReader(content), base)
+	if err != nil {
+		return 0, fmt.Errorf("%w (%v)", ErrInvalidContent, err)
+	}
+	if feed.Title == "" {
+		feed.Title = f.Name
+	}
+	n := writeItemsToDB(db, feed, f.Abbr, f.Location())
+	pushedItems.Add(int64(n))
+	now := time.Now()
+	if result := db.Model(&f).Update("last_success", &now); result.Error != nil {
+		log.Printf("Error saving push time for %v: %v", f.Name, result.Error)
+	}
+	return n, nil
+}
+
+// validSignature checks an X-Hub-Signature header ("sha256=<hex>", also sha1, sha384 and sha512) against content.
+func validSignature(secret string, signature string, content []byte) bool {
+	method, sig, _ := strings.Cut(strings.TrimSpace(signature), "=")
+	var h func() hash.Hash
+	switch strings.ToLower(method) {
+	case "sha1":
+		h = sha1.New
+	case "sha256":
+		h = sha256.New
+	case "sha384":
+		h = sha512.New384
+	case "sha512":
+		h = sha512.New
+	default:
+		return false
+	}
+	expected, err := hex.DecodeString(sig)
+	if err != nil || secret == "" {
+		return false
+	}
+	mac := hmac.New(h, []byte(secret))
+	mac.Write(content)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
@@ -17,6 +17,7 @@ import (
 	_ "time/tzdata"
 
 	"github.com/signalstoerung/reader/internal/cache"
+	"github.com/signalstoerung/reader/internal/deepl"
 	"github.com/signalstoerung/reader/internal/feeds"
 	"github.com/signalstoerung/reader/internal/newsticker"
 	"github.com/signalstoerung/reader/internal/openai"
@@ -34,10 +35,28 @@ type Config struct {
 	Secret            string `yaml:"secret"`
 	ResultsPerPage    int    `yaml:"resultsPerPage"`
 	DeeplApiKey       string `yaml:"deeplApiKey"`
+	DeeplApiUrl       string `yaml:"deeplApiUrl"`
+	DeeplTargetLang   string `yaml:"deeplTargetLang"`
 	OpenAIToken       string `yaml:"openAiToken"`
-	Debug             bool   `yaml:"-"`
-	AIActive          bool   `yaml:"-"`
-	localTZ           *time.Location
+	// retention: 0 disables the respective limit
+	RetentionDays            int `yaml:"retentionDays"`
+	RetentionMaxItemsPerFeed int `yaml:"retentionMaxItemsPerFeed"`
+	VacuumIntervalHours      int `yaml:"vacuumIntervalHours"`
+	// fetcher: 0 (or "") selects the defaults
+	FetchWorkers        int    `yaml:"fetchWorkers"`
+	FetchTimeoutSeconds int    `yaml:"fetchTimeoutSeconds"`
+	HostDelaySeconds    int    `yaml:"hostDelaySeconds"`
+	UserAgent           string `yaml:"userAgent"`
+	// newsletters: Maildir/mbox root, and the address of the built-in SMTP listener ("" disables it)
+	MailboxDir string `yaml:"mailboxDir"`
+	SMTPListen string `yaml:"smtpListen"`
+	// WebSub: the URL Reader is reachable at from the internet ("" disables push subscriptions)
+	PublicUrl string `yaml:"publicUrl"`
+	// item API: bearer token for submitting items ("" disables the API)
+	ApiToken string `yaml:"apiToken"`
+	Debug    bool   `yaml:"-"`
+	AIActive bool   `yaml:"-"`
+	localTZ  *time.Location
 }
 
 /* Global variables */
@@ -76,6 +95,7 @@ func loadConfig(path string) error {
 		globalConfig.localTZ = time.FixedZone("Local", offset)
 	}
 	openai.Stats.ApiKey = globalConfig.OpenAIToken
+	deepl.Config.Configure(globalConfig.DeeplApiKey, globalConfig.DeeplApiUrl, globalConfig.DeeplTargetLang)
 	return nil
 }
 
@@ -94,15 +114,15 @@ func openDBConnection(path string) error {
 // initializeDB is called only if the database does not exist. It creates the necessary tables and seeds the DB with a few feeds.
 func initializeDB() {
 	feeds.CreateFeed(feeds.Feed{Name: "NYT Wire", Abbr: "NYT", Url: "https://content.api.nytimes.com/svc/news/v3/all/recent.rss"})
-	feeds.CreateFeed(feeds.Feed{Name: "NOS Nieuws Algemeen", Abbr: "NOS", Url: "https://feeds.nos.nl/nosnieuwsalgemeen"})
-	feeds.CreateFeed(feeds.Feed{Name: "Tagesschau", Abbr: "ARD", Url: "https://www.tagesschau.de/infoservices/alle-meldungen-100~rss2.xml"})
+	feeds.CreateFeed(feeds.Feed{Name: "NOS Nieuws Algemeen", Abbr: "NOS", Url: "https://feeds.nos.nl/nosnieuwsalgemeen", Language: "NL"})
+	feeds.CreateFeed(feeds.Feed{Name: "Tagesschau", Abbr: "ARD", Url: "https://www.tagesschau.de/infoservices/alle-meldungen-100~rss2.xml", Language: "DE"})
 	feeds.CreateFeed(feeds.Feed{Name: "CNBC Business", Abbr: "CNBC", Url: "https://search.cnbc.com/rs/search/combinedcms/view.xml?partnerId=wrss01&id=10001147"})
 
 	// allow new user registrations on initialization
 	registrationsOpen = true
 
 	// load feeds
-	if err := feeds.UpdateFeeds(); err != nil {
+	if err := feeds.UpdateFeeds(context.Background()); err != nil {
 		log.Printf("encountered an error: %v", err)
 		os.Exit(1)
 	}
@@ -128,6 +148,7 @@ func main() {
 	flag.BoolVar(&registrationsOpen, "register", false, "Allow registration once at startup")
 	flag.StringVar(&promptFile, "promptfile", "db/gpt-prompt.txt", "File containing the GPT prompt for headline scoring")
 	flag.Parse()
+
 	// load config
 	if err := loadConfig(configFilePath); err != nil {
 		log.Printf("Couldn't load configuation (%v).", err)
@@ -137,6 +158,13 @@ func main() {
 	globalConfig.Debug = debug
 	globalConfig.AIActive = aiActive
 	openai.Debug = debug
+	deepl.Debug = debug
+	feeds.Config.SetDefaultInterval(globalConfig.UpdateFrequency)
+	feeds.Config.SetSecret(globalConfig.Secret)
+	feeds.Config.SetFetcher(globalConfig.FetchWorkers, time.Duration(globalConfig.FetchTimeoutSeconds)*time.Second, time.Duration(globalConfig.HostDelaySeconds)*time.Second, globalConfig.UserAgent)
+	feeds.Config.SetRetention(time.Duration(globalConfig.RetentionDays)*24*time.Hour, globalConfig.RetentionMaxItemsPerFeed)
+	feeds.Config.SetMailboxDir(globalConfig.MailboxDir)
+	feeds.Config.SetWebSub(globalConfig.PublicUrl)
 
 	if aiActive {
 		log.Println("AI headline scoring active.")
@@ -168,6 +196,15 @@ func main() {
 		}
 	}
 
+	// if a command is given (e.g. import-opml), run it against the database instead of starting the server
+	if flag.NArg() > 0 {
+		if err := runCommand(flag.Args()); err != nil {
+			log.Printf("%v failed: %v", flag.Arg(0), err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// set ticker channel on feeds.Config
 	feeds.Config.SetTickerChannel(tickerChannel)
 	// launch ticker consumer
@@ -185,6 +222,8 @@ func main() {
 	http.HandleFunc("/archiveorg/", users.SessionMiddleware("/login/", archiveOrgHandler))
 	http.HandleFunc("/proxy/", users.SessionMiddleware("/login/", proxyHandler))
 	http.HandleFunc("/newsticker/", users.SessionMiddleware("/login/", newstickerHandler))
+	http.HandleFunc(feeds.WebSubPath, websubHandler)
+	http.HandleFunc("/api/items", itemApiHandler)
 	// removing session checks for debugging
 	// http.HandleFunc("/newsticker/", newstickerHandler)
 	staticFileHandler := http.FileServer(http.Dir("./www"))
@@ -209,12 +248,25 @@ func main() {
 		go newsticker.SimulateTicker(cancelSimulator)
 	}
 
-	// start a ticker for periodic refresh using the const updateFrequency
-	tickerUpdating := time.NewTicker(time.Duration(globalConfig.UpdateFrequency) * time.Minute)
+	// start a ticker for the feed scheduler; each feed is fetched when its own interval is due
+	tickerUpdating := time.NewTicker(feeds.SchedulerTick)
 	quit := make(chan int)
 	defer close(quit)
-	log.Printf("Starting ticker for periodic update (%v minutes).", globalConfig.UpdateFrequency)
-	go periodicUpdates(tickerUpdating, quit)
+	fetchCtx, cancelFetches := context.WithCancel(context.Background())
+	log.Printf("Starting feed scheduler (default interval %v minutes).", globalConfig.UpdateFrequency)
+	go periodicUpdates(fetchCtx, tickerUpdating, quit)
+	if globalConfig.SMTPListen != "" {
+		go func() {
+			log.Printf("Accepting newsletters by SMTP on %v.", globalConfig.SMTPListen)
+			if err := feeds.ListenSMTP(fetchCtx, globalConfig.SMTPListen); err != nil {
+				log.Printf("SMTP listener stopped: %v", err)
+			}
+		}()
+	}
+	if globalConfig.RetentionDays > 0 || globalConfig.RetentionMaxItemsPerFeed > 0 {
+		log.Printf("Starting pruning (max age %v days, max %v items per feed).", globalConfig.RetentionDays, globalConfig.RetentionMaxItemsPerFeed)
+		go periodicPruning(quit)
+	}
 
 	// Channel to listen for interrupt signals
 	sigChan := make(chan os.Signal, 1)
@@ -233,8 +285,9 @@ func main() {
 	<-sigChan
 	log.Println("Shutting down gracefully...")
 
-	// Stop the ticker
+	// Stop the ticker and abort fetches in progress
 	tickerUpdating.Stop()
+	cancelFetches()
 	cache.CleanTicker.Stop()
 	close(cancelNewsticker)
 	close(cancelSimulator)
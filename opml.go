@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/signalstoerung/reader/internal/feeds"
+	"golang.org/x/exp/slices"
+)
+
+// importOPML reads an OPML document and creates a feed for every outline whose URL is not yet subscribed.
+// Abbreviations are derived from the outline title. Returns the names of the added and skipped feeds.
+func importOPML(r io.Reader) (added []string, skipped []string, err error) {
+	candidates, err := feeds.ParseOPML(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	existing, err := feeds.AllFeeds()
+	if err != nil {
+		return nil, nil, err
+	}
+	abbrTaken := func(abbr string) bool {
+		return slices.ContainsFunc(existing, func(elem feeds.Feed) bool {
+			return elem.Abbr == abbr
+		})
+	}
+	for _, c := range candidates {
+		if slices.ContainsFunc(existing, func(elem feeds.Feed) bool {
+			return elem.Url == c.Url
+		}) {
+			skipped = append(skipped, fmt.Sprintf("%v (already subscribed)", c.Name))
+			continue
+		}
+		name := cleanFeedName(c.Name)
+		if name == "" {
+			name = "Imported feed"
+		}
+		abbr := abbrFromName(name, abbrTaken)
+		if abbr == "" {
+			skipped = append(skipped, fmt.Sprintf("%v (no free abbreviation)", c.Name))
+			continue
+		}
+		feed, err := checkFeedForm(name, abbr, c.Url, "", "", "")
+		if err == nil {
+			err = checkSourceForm(&feed, feeds.TypeRSS, feeds.ScrapeSelectors{})
+		}
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%v (%v)", c.Name, err))
+			continue
+		}
+		if err := feeds.CreateFeed(feed); err != nil {
+			skipped = append(skipped, fmt.Sprintf("%v (%v)", c.Name, err))
+			continue
+		}
+		existing = append(existing, feed)
+		added = append(added, fmt.Sprintf("%v [%v]", feed.Name, feed.Abbr))
+	}
+	return added, skipped, nil
+}
+
+// runCommand executes a command given on the command line instead of starting the server.
+// Supported commands: import-opml <file>, export-opml [file] (stdout if no file is given).
+func runCommand(args []string) error {
+	switch args[0] {
+	case "import-opml":
+		if len(args) < 2 {
+			return fmt.Errorf("missing argument: import-opml <file>")
+		}
+		f, err := os.Open(args[1])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		added, skipped, err := importOPML(f)
+		if err != nil {
+			return err
+		}
+		for _, a := range added {
+			log.Printf("Added %v", a)
+		}
+		for _, s := range skipped {
+			log.Printf("Skipped %v", s)
+		}
+		return nil
+	case "export-opml":
+		list, err := feeds.AllFeeds()
+		if err != nil {
+			return err
+		}
+		out := os.Stdout
+		if len(args) > 1 {
+			out, err = os.Create(args[1])
+			if err != nil {
+				return err
+			}
+			defer out.Close()
+		}
+		return feeds.WriteOPML(out, list)
+	case "migrate-hashes":
+		merged, updated, err := feeds.MigrateCanonicalHashes()
+		if err != nil {
+			return err
+		}
+		log.Printf("Merged %d duplicate items, updated %d hashes.", merged, updated)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %v", args[0])
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/signalstoerung/reader/internal/feeds"
+	"golang.org/x/exp/slices"
+)
+
+// parseQuery turns a search box query such as
+//
+//	feed:NYT score>80 after:2026-10-01 -sports "interest rate" is:saved
+//
+// into a feeds.ItemQuery. Supported operators: feed:ABBR, after:DATE, before:DATE (YYYY-MM-DD, local time zone),
+// category:NAME (or category:"two words"), score>N, score>=N, score<N, score<=N, score:N, is:saved and -term / -"phrase" for exclusions.
+// Everything else is free text. user is the logged-in user (for is:saved).
+func parseQuery(s string, feedlist []feeds.Feed, user string) (feeds.ItemQuery, error) {
+	var q feeds.ItemQuery
+	var text []string
+	for _, token := range tokenizeQuery(s) {
+		if strings.HasPrefix(token, "-") && len(token) > 1 {
+			// a quoted phrase keeps its quotes, so only the whole phrase is excluded
+			q.Exclude = append(q.Exclude, token[1:])
+			continue
+		}
+		if strings.HasPrefix(token, `"`) {
+			text = append(text, token)
+			continue
+		}
+		lower := strings.ToLower(token)
+		switch {
+		case strings.HasPrefix(lower, "feed:"):
+			abbr := token[len("feed:"):]
+			idx := slices.IndexFunc(feedlist, func(elem feeds.Feed) bool {
+				return strings.EqualFold(elem.Abbr, abbr)
+			})
+			if idx == -1 {
+				return q, fmt.Errorf("unknown feed '%s'", abbr)
+			}
+			q.Feed = feedlist[idx].Abbr
+		case strings.HasPrefix(lower, "category:"):
+			q.Category = strings.Trim(token[len("category:"):], `"`)
+			if q.Category == "" {
+				return q, fmt.Errorf("missing category name")
+			}
+		case strings.HasPrefix(lower, "after:"), strings.HasPrefix(lower, "before:"):
+			key, value, _ := strings.Cut(lower, ":")
+			date, err := time.ParseInLocation("2006-01-02", value, globalConfig.localTZ)
+			if err != nil {
+				return q, fmt.Errorf("invalid date '%s' for %s (use YYYY-MM-DD)", value, key)
+			}
+			if key == "after" {
+				q.After = &date
+			} else {
+				q.Before = &date
+			}
+		case isScoreFilter(lower):
+			if err := parseScore(lower, &q); err != nil {
+				return q, err
+			}
+		case lower == "is:saved":
+			q.SavedBy = user
+		default:
+			text = append(text, token)
+		}
+	}
+	q.Search = strings.Join(text, " ")
+	return q, nil
+}
+
+// isScoreFilter reports whether token is a score bound like score>80 (and not just a word starting with "score").
+func isScoreFilter(token string) bool {
+	rest, found := strings.CutPrefix(token, "score")
+	return found && rest != "" && strings.ContainsRune("<>:=", rune(rest[0]))
+}
+
+// parseScore parses a score bound (score>80, score<=50, score:90) into q.
+func parseScore(token string, q *feeds.ItemQuery) error {
+	rest := strings.TrimPrefix(token, "score")
+	var op string
+	for _, candidate := range []string{">=", "<=", ">", "<", ":", "="} {
+		if strings.HasPrefix(rest, candidate) {
+			op = candidate
+			break
+		}
+	}
+	if op == "" {
+		return fmt.Errorf("invalid score filter '%s' (use e.g. score>80)", token)
+	}
+	n, err := strconv.Atoi(rest[len(op):])
+	if err != nil {
+		return fmt.Errorf("invalid score filter '%s' (use e.g. score>80)", token)
+	}
+	switch op {
+	case ">=":
+		q.MinScore = &n
+	case ">":
+		n++
+		q.MinScore = &n
+	case "<=":
+		q.MaxScore = &n
+	case "<":
+		n--
+		q.MaxScore = &n
+	default:
+		lower, upper := n, n
+		q.MinScore, q.MaxScore = &lower, &upper
+	}
+	return nil
+}
+
+// tokenizeQuery splits a query at whitespace. Text in double quotes stays together (including the quotes),
+// also when preceded by a minus sign.
+func tokenizeQuery(s string) []string {
+	var tokens []string
+	var current strings.Builder
+	inQuotes := false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			current.WriteRune(r)
+			inQuotes = !inQuotes
+		case unicode.IsSpace(r) && !inQuotes:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/signalstoerung/reader/internal/feeds"
+)
+
+const pruneInterval = 1 * time.Hour
+
+// periodicPruning deletes expired items every hour and vacuums the database every VacuumIntervalHours hours,
+// according to the retention settings in the config. It terminates when the q (quit) channel closes.
+func periodicPruning(q chan int) {
+	vacuumInterval := time.Duration(globalConfig.VacuumIntervalHours) * time.Hour
+	if vacuumInterval <= 0 {
+		vacuumInterval = 24 * time.Hour
+	}
+	pruneTicker := time.NewTicker(pruneInterval)
+	vacuumTicker := time.NewTicker(vacuumInterval)
+	defer pruneTicker.Stop()
+	defer vacuumTicker.Stop()
+	for {
+		select {
+		case <-pruneTicker.C:
+			deleted, err := feeds.PruneItems()
+			if err != nil {
+				log.Printf("Error pruning items: %v", err)
+				continue
+			}
+			if deleted > 0 {
+				log.Printf("Pruned %d expired items.", deleted)
+			}
+		case <-vacuumTicker.C:
+			log.Print("Vacuuming database.")
+			if err := feeds.Vacuum(); err != nil {
+				log.Printf("Error vacuuming database: %v", err)
+			}
+		case <-q:
+			return
+		}
+	}
+}
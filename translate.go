@@ -0,0 +1,51 @@
+package main
+
+import (
+	"log"
+
+	"github.com/signalstoerung/reader/internal/deepl"
+	"github.com/signalstoerung/reader/internal/feeds"
+)
+
+// translateBatchSize is the number of items translated per feed and call; each item needs two texts (title and description).
+const translateBatchSize = deepl.MaxTextsPerCall / 2
+
+// translateNewItems translates the titles and descriptions of untranslated items from all feeds that have a source language set.
+func translateNewItems() {
+	if !deepl.Config.Active() {
+		return
+	}
+	feedlist, err := feeds.AllFeeds()
+	if err != nil {
+		log.Printf("Error loading feeds for translation: %v", err)
+		return
+	}
+	for _, feed := range feedlist {
+		if feed.Language == "" {
+			continue
+		}
+		items, err := feeds.UntranslatedItems(feed.Abbr, translateBatchSize)
+		if err != nil {
+			log.Printf("Error loading items to translate for %v: %v", feed.Abbr, err)
+			continue
+		}
+		if len(items) == 0 {
+			continue
+		}
+		texts := make([]string, 0, 2*len(items))
+		for _, item := range items {
+			texts = append(texts, item.Title, item.Description)
+		}
+		translated, err := deepl.Translate(texts, feed.Language)
+		if err != nil {
+			log.Printf("Error translating items of %v: %v", feed.Abbr, err)
+			continue
+		}
+		for i, item := range items {
+			if err := feeds.SaveTranslation(item.ID, translated[2*i], translated[2*i+1]); err != nil {
+				log.Printf("Error saving translation for item %v: %v", item.ID, err)
+			}
+		}
+		log.Printf("Translated %d items of %v from %v.", len(items), feed.Abbr, feed.Language)
+	}
+}
@@ -6,21 +6,33 @@ feedSelector.addEventListener('change', (event) => {
   const params = new URL(location).searchParams;
   const search = params.get('q');
   if (search) {
-    location.search = `feed=${feed}&q=${search}`;
+    location.search = `feed=${feed}&q=${encodeURIComponent(search)}`;
   } else {
     location.search = `feed=${feed}`;
   }
 //  location.reload;
 });
 
+const categorySelector = document.getElementById('category');
+if (categorySelector) {
+  categorySelector.addEventListener('change', (event) => {
+    const category = event.target.value;
+    const params = new URL(window.location).searchParams;
+    params.set('category', category);
+    params.delete('page');
+    params.delete('timestamp');
+    window.location.search = params.toString();
+  });
+}
+
 function redirect(searchTerms){
   const location = window.location;
   const params = new URL(location).searchParams;
   const feed = params.get('feed');
   if (feed) {
-    location.search = `?q=${searchTerms}&feed=${feed}`
+    location.search = `?q=${encodeURIComponent(searchTerms)}&feed=${feed}`
   } else {
-    location.search = `q=${searchTerms}`;
+    location.search = `q=${encodeURIComponent(searchTerms)}`;
   }
   //location.reload;
 }